@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gocasesapi/log"
+	"gocasesapi/multiscraper"
+	"gocasesapi/util"
+	"os"
+	"strings"
+	"time"
+)
+
+// Everything main can be told. Every setting is a flag, and can also be given in a json file
+// passed with -config whose keys are flag names, flags given on the command line win
+type config struct {
+	scrape         multiscraper.Options
+	limiter        multiscraper.LimiterConfig
+	client         multiscraper.ClientConfig
+	proxyPool      multiscraper.ProxyPoolConfig
+	proxyFile      string
+	userAgentFile  string
+	markersPath    string
+	ignoreRobots   string
+	pagesDir       string
+	cacheDir       string
+	cacheTTL       time.Duration
+	refresh        bool
+	recordDir      string
+	replayDir      string
+	warcPath       string
+	maxFailureRate float64
+	progress       multiscraper.ProgressMode
+	progressEvery  time.Duration
+	every          time.Duration
+	metricsAddr    string
+}
+
+func parseConfig(args []string) (config, error) {
+	c := config{
+		scrape:    multiscraper.DefaultOptions,
+		limiter:   multiscraper.DefaultLimiterConfig,
+		client:    multiscraper.DefaultClientConfig,
+		proxyPool: multiscraper.DefaultProxyPoolConfig,
+	}
+	// A set of its own rather than the global one, so tests can parse more than once
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	configPath := flags.String("config", "", "json file of flag names to values, flags given on the command line take precedence")
+
+	// Rate limiting and retries
+	flags.Float64Var(&c.limiter.PerSecond, "per-second", c.limiter.PerSecond, "sustained number of requests per second sent to each host")
+	flags.IntVar(&c.limiter.Burst, "burst", c.limiter.Burst, "number of requests a host can be sent back to back after being idle")
+	flags.BoolVar(&c.limiter.Adaptive, "adaptive", c.limiter.Adaptive, "slow down hosts that answer slowly or with 429/503")
+	flags.DurationVar(&c.limiter.TargetLatency, "target-latency", c.limiter.TargetLatency, "responses slower than this slow the host down in adaptive mode")
+	flags.Float64Var(&c.limiter.MinPerSecond, "min-per-second", c.limiter.MinPerSecond, "lowest rate adaptive mode will slow a host down to")
+	flags.IntVar(&c.scrape.Fetchers, "fetchers", c.scrape.Fetchers, "number of pages fetched at the same time")
+	flags.IntVar(&c.scrape.Parsers, "parsers", c.scrape.Parsers, "number of pages parsed at the same time")
+	flags.IntVar(&c.scrape.Retry.MaxAttempts, "max-attempts", c.scrape.Retry.MaxAttempts, "attempts made for each url before giving up on it")
+	flags.DurationVar(&c.scrape.Retry.BaseDelay, "retry-base-delay", c.scrape.Retry.BaseDelay, "upper bound of the first retry backoff, doubled on every attempt")
+	flags.DurationVar(&c.scrape.Retry.MaxDelay, "retry-max-delay", c.scrape.Retry.MaxDelay, "longest backoff between two attempts")
+
+	// Http client
+	flags.DurationVar(&c.client.DialTimeout, "dial-timeout", c.client.DialTimeout, "time allowed to open a connection")
+	flags.DurationVar(&c.client.TLSHandshakeTimeout, "tls-timeout", c.client.TLSHandshakeTimeout, "time allowed for the tls handshake")
+	flags.DurationVar(&c.client.ResponseHeaderTimeout, "header-timeout", c.client.ResponseHeaderTimeout, "time allowed between sending a request and receiving the response headers")
+	flags.DurationVar(&c.client.RequestTimeout, "request-timeout", c.client.RequestTimeout, "time allowed for a whole request including the body, 0 for no limit")
+	flags.Int64Var(&c.client.MaxResponseBytes, "max-body-bytes", c.client.MaxResponseBytes, "largest response body accepted, 0 for no limit")
+	flags.IntVar(&c.client.MaxIdleConnsPerHost, "max-idle-conns-per-host", c.client.MaxIdleConnsPerHost, "idle keep-alive connections kept open per host")
+	flags.IntVar(&c.client.MaxConnsPerHost, "max-conns-per-host", c.client.MaxConnsPerHost, "connections open to a single host at once, 0 for no limit")
+	flags.DurationVar(&c.client.IdleConnTimeout, "idle-conn-timeout", c.client.IdleConnTimeout, "how long an idle keep-alive connection is kept open")
+
+	// Proxies and user agents
+	flags.StringVar(&c.proxyFile, "proxies", "", "file of proxy urls, one per line, that requests are spread over")
+	flags.Float64Var(&c.proxyPool.MaxErrorRate, "proxy-max-error-rate", c.proxyPool.MaxErrorRate, "share of recent requests a proxy may fail before it is benched")
+	flags.DurationVar(&c.proxyPool.MaxLatency, "proxy-max-latency", c.proxyPool.MaxLatency, "average latency a proxy may have before it is benched, 0 for no limit")
+	flags.IntVar(&c.proxyPool.MinRequests, "proxy-min-requests", c.proxyPool.MinRequests, "requests a proxy has to serve before its health is judged")
+	flags.DurationVar(&c.proxyPool.Cooldown, "proxy-cooldown", c.proxyPool.Cooldown, "how long a benched proxy is left out of rotation")
+	flags.StringVar(&c.userAgentFile, "user-agents", "", "file of user agents, one per line, picked from at random for every request. robots.txt is still followed for gocasesapi, so they should name it")
+	flags.StringVar(&c.ignoreRobots, "ignore-robots", "", "comma separated hosts whose robots.txt is not followed, such as mirrors we run, * for every host")
+
+	// Where pages come from and where they are kept
+	flags.StringVar(&c.markersPath, "page-markers", "", "json file of markers that give away challenge, maintenance and soft 404 pages, replacing the built in ones per kind")
+	flags.StringVar(&c.pagesDir, "pages-dir", "", "read pages from this directory instead of the network, laid out as host/path.html")
+	flags.StringVar(&c.cacheDir, "cache-dir", "cache/http", "directory pages are cached in, empty to disable the cache")
+	flags.DurationVar(&c.cacheTTL, "cache-ttl", 0, "how long a cached page is used without asking the server, 0 revalidates every page")
+	flags.BoolVar(&c.refresh, "refresh", false, "ignore the cache and download every page again")
+	flags.StringVar(&c.recordDir, "record", "", "save every fetched page into this archive directory")
+	flags.StringVar(&c.replayDir, "replay", "", "scrape purely from pages recorded into this archive directory")
+	flags.StringVar(&c.warcPath, "warc", "", "write every request and response sent over the network to this WARC file (.warc or .warc.gz) and link items back to it, items from cached pages link to the record the page was cached from")
+
+	// Progress and outcome
+	flags.StringVar(&c.scrape.Checkpoint.Path, "checkpoint-dir", "checkpoints", "directory progress is saved to so an interrupted scrape can be resumed, empty to disable")
+	flags.DurationVar(&c.scrape.Checkpoint.Interval, "checkpoint-interval", 30*time.Second, "how often progress is saved during a scrape")
+	flags.BoolVar(&c.scrape.Checkpoint.Resume, "resume", false, "skip urls already scraped by an interrupted run and merge in its results")
+	flags.Float64Var(&c.maxFailureRate, "max-failure-rate", 0.05, "exit with an error when more than this share of urls fail")
+	flags.Var(&c.scrape.Collisions, "on-collision", "what to do when two different items get the same key: fail (the default, the output is not written and the run exits non-zero), keep-first or suffix")
+
+	// Progress and metrics
+	flags.Var(&c.progress, "progress", "how progress is shown on stderr: auto (a line on a terminal, json events otherwise), line, json or off")
+	flags.DurationVar(&c.progressEvery, "progress-interval", 10*time.Second, "time between json progress events")
+	flags.StringVar(&c.metricsAddr, "metrics-addr", "", "address such as 127.0.0.1:9100 to serve prometheus metrics on at /metrics while scraping, off when empty")
+	flags.DurationVar(&c.every, "every", 0, "run as a daemon scraping again this long after every run started, serving metrics in between, 0 to scrape once and exit")
+
+	if err := flags.Parse(args); err != nil {
+		return c, err
+	}
+	if *configPath != "" {
+		if err := applyConfigFile(flags, *configPath); err != nil {
+			return c, err
+		}
+	}
+	if c.warcPath != "" && (c.replayDir != "" || c.pagesDir != "") {
+		return c, errors.New("-warc only archives pages downloaded over the network, it cannot be used with -replay or -pages-dir")
+	}
+	return c, nil
+}
+
+// Set every flag named in a json config file that was not given on the command line
+func applyConfigFile(flags *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Numbers are passed on as written, as a float64 16777216 would be printed as 1.6777216e+07
+	// which integer flags refuse
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	for name, value := range values {
+		if flags.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		if given[name] {
+			continue
+		}
+		if err := flags.Set(name, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+	}
+	return nil
+}
+
+// Http fetcher with the proxies and user agents named in the config
+func (c config) httpFetcher() (*multiscraper.HTTPFetcher, error) {
+	fetcher := multiscraper.NewHTTPFetcher(c.client)
+	if c.userAgentFile != "" {
+		userAgents, err := util.ReadLines(c.userAgentFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, userAgent := range userAgents {
+			if userAgent = strings.TrimSpace(userAgent); userAgent != "" {
+				fetcher.UserAgents = append(fetcher.UserAgents, userAgent)
+			}
+		}
+	}
+	if c.proxyFile != "" {
+		proxies, err := util.ReadLines(c.proxyFile)
+		if err != nil {
+			return nil, err
+		}
+		fetcher.Proxies, err = multiscraper.NewProxyPool(proxies, c.proxyPool)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fetcher, nil
+}
+
+// Hosts named by -ignore-robots
+func (c config) robotsIgnored() []string {
+	var hosts []string
+	for _, host := range strings.Split(c.ignoreRobots, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// Where pages come from, built from the config, along with the parts of it main reports on
+type sources struct {
+	fetcher multiscraper.Fetcher
+	http    *multiscraper.HTTPFetcher
+	cache   *multiscraper.CachingFetcher
+	closers []func() error
+}
+
+// Build the fetcher chain: pages come from a replay archive, a pages directory or the network,
+// with those from the network optionally written to a WARC file as they arrive. Pages are then
+// checked to be content, go through the cache and are optionally recorded
+func (c config) openSources() (*sources, error) {
+	classifier := multiscraper.DefaultClassifier
+	if c.markersPath != "" {
+		var err error
+		classifier, err = multiscraper.LoadClassifier(c.markersPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Every exchange is archived as it comes over the network, pages that are not content are
+	// turned away before anything gets to cache or record them
+	s := &sources{}
+	var base multiscraper.Fetcher
+	if c.replayDir != "" {
+		replay, err := multiscraper.NewReplayFetcher(c.replayDir)
+		if err != nil {
+			return nil, err
+		}
+		base = replay
+	} else if c.pagesDir != "" {
+		base = multiscraper.DirFetcher{Root: c.pagesDir}
+	} else {
+		httpFetcher, err := c.httpFetcher()
+		if err != nil {
+			return nil, err
+		}
+		s.http = httpFetcher
+		base = httpFetcher
+		if c.warcPath != "" {
+			writer, err := multiscraper.NewWARCWriter(c.warcPath)
+			if err != nil {
+				return nil, err
+			}
+			s.closers = append(s.closers, writer.Close)
+			base = &multiscraper.WARCFetcher{Inner: base, Writer: writer}
+		}
+	}
+	s.fetcher = &multiscraper.ClassifyingFetcher{Inner: base, Classifier: classifier}
+	if s.http != nil && c.cacheDir != "" {
+		s.cache = multiscraper.NewCachingFetcher(c.cacheDir, s.fetcher, c.cacheTTL)
+		s.cache.ForceRefresh = c.refresh
+		s.fetcher = s.cache
+	}
+	if c.recordDir != "" {
+		recorder, err := multiscraper.NewRecordingFetcher(c.recordDir, s.fetcher)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.closers = append(s.closers, recorder.Close)
+		s.fetcher = recorder
+	}
+	return s, nil
+}
+
+func (s *sources) logStats() {
+	if s.cache != nil {
+		stats := s.cache.Stats()
+		log.Info.Printf("Cache: %d hits, %d revalidated, %d misses", stats.Hits, stats.Revalidated, stats.Misses)
+	}
+	if s.http != nil && s.http.Proxies != nil {
+		for _, stats := range s.http.Proxies.Stats() {
+			log.Info.Printf("Proxy %s: %d requests, %d failures, %s average latency, benched: %t", stats.URL, stats.Requests, stats.Failures, stats.Latency.Round(time.Millisecond), stats.Benched)
+		}
+	}
+}
+
+func (s *sources) Close() {
+	for _, close := range s.closers {
+		if err := close(); err != nil {
+			log.Warning.Println(err)
+		}
+	}
+	s.closers = nil
+}
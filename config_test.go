@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, json string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(json), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigFile(t *testing.T) {
+	path := writeConfig(t, `{
+		"max-body-bytes": 16777216,
+		"per-second": 2.5,
+		"burst": 10,
+		"adaptive": true,
+		"cache-ttl": "1h",
+		"ignore-robots": "mirror.example"
+	}`)
+	c, err := parseConfig([]string{"-config", path, "-burst", "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.client.MaxResponseBytes != 16777216 {
+		t.Errorf("max-body-bytes = %d, want 16777216", c.client.MaxResponseBytes)
+	}
+	if c.limiter.PerSecond != 2.5 || !c.limiter.Adaptive || c.cacheTTL != time.Hour || c.ignoreRobots != "mirror.example" {
+		t.Errorf("config = %+v", c)
+	}
+	// The command line wins over the file
+	if c.limiter.Burst != 3 {
+		t.Errorf("burst = %d, want 3 from the command line", c.limiter.Burst)
+	}
+
+	if _, err := parseConfig([]string{"-config", writeConfig(t, `{"per-secnod": 2}`)}); err == nil {
+		t.Error("unknown setting was accepted")
+	}
+	if _, err := parseConfig([]string{"-config", writeConfig(t, `{"burst": 2.5}`)}); err == nil {
+		t.Error("fraction was accepted for an integer flag")
+	}
+}
+
+func TestWARCNeedsTheNetwork(t *testing.T) {
+	for _, source := range []string{"-replay", "-pages-dir"} {
+		if _, err := parseConfig([]string{"-warc", "run.warc", source, "pages"}); err == nil {
+			t.Errorf("-warc was accepted along with %s", source)
+		}
+	}
+	if _, err := parseConfig([]string{"-warc", "run.warc"}); err != nil {
+		t.Errorf("-warc on its own: %s", err)
+	}
+}
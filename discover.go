@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gocasesapi/games/cs2"
+	"gocasesapi/log"
+	"gocasesapi/multiscraper"
+	"gocasesapi/util"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Links files the discover command regenerates, keyed by the kind of link they hold
+var discoveredFiles = map[cs2.LinkKind]string{
+	cs2.LinkCase:           "links/cs2/cases.txt",
+	cs2.LinkCollection:     "links/cs2/collections.txt",
+	cs2.LinkStickerCapsule: "links/cs2/sticker_capsules.txt",
+	cs2.LinkSkin:           "links/cs2/skins.txt",
+}
+
+// Crawl csgostash from the index pages in links/cs2/discover.txt, print how the links files
+// differ from what was found and rewrite them. Files are only rewritten when every page was
+// crawled, so a flaky run cannot drop links. Returns whether the crawl was complete
+func discover(ctx context.Context, opts multiscraper.Options) bool {
+	seeds, err := util.ReadLines("links/cs2/discover.txt")
+	if err != nil {
+		log.Error.Println(err)
+		return false
+	}
+	// Discovery is quick to redo, there is nothing worth resuming
+	opts.Checkpoint = multiscraper.CheckpointOptions{}
+
+	log.Info.Printf("Discovering links from %d index pages", len(seeds))
+	found := make(map[string]cs2.DiscoveredLink)
+	run := multiscraper.MultiScrape[cs2.DiscoveredLink](ctx, seeds, found, opts, multiscraper.ScraperFunc[cs2.DiscoveredLink](cs2.DiscoverLinks))
+	complete := run.Status == multiscraper.StatusComplete && run.Count(multiscraper.URLFailed) == 0
+	log.Info.Printf("Crawled %d pages, %d failed, %d skipped", run.Count(multiscraper.URLScraped), run.Count(multiscraper.URLFailed), run.Count(multiscraper.URLSkipped))
+
+	byKind := make(map[cs2.LinkKind][]string)
+	for _, link := range found {
+		byKind[link.Kind] = append(byKind[link.Kind], link.URL)
+	}
+
+	kinds := make([]cs2.LinkKind, 0, len(discoveredFiles))
+	for kind := range discoveredFiles {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+
+	for _, kind := range kinds {
+		path := discoveredFiles[kind]
+		current, err := util.ReadLines(path)
+		if err != nil && !os.IsNotExist(err) {
+			log.Error.Println(err)
+			complete = false
+			continue
+		}
+		lines, added, removed := mergeLinks(current, byKind[kind])
+		fmt.Printf("%s: %d added, %d removed\n", path, len(added), len(removed))
+		for _, link := range added {
+			fmt.Printf("+ %s\n", link)
+		}
+		for _, link := range removed {
+			fmt.Printf("- %s\n", link)
+		}
+		if !complete || len(lines) == 0 || (len(added) == 0 && len(removed) == 0) {
+			continue
+		}
+		if err := writeLines(path, lines); err != nil {
+			log.Error.Println(err)
+			complete = false
+		}
+	}
+	if !complete {
+		log.Warning.Println("Discovery was incomplete, links files were left untouched")
+	}
+	return complete
+}
+
+// Keep the links that are still around in the order the file has them and add new ones to
+// the end in sorted order, so the diff of a links file only shows what changed
+func mergeLinks(current []string, found []string) (lines []string, added []string, removed []string) {
+	isFound := make(map[string]bool, len(found))
+	for _, link := range found {
+		isFound[link] = true
+	}
+	isCurrent := make(map[string]bool, len(current))
+	for _, link := range current {
+		if link == "" || isCurrent[link] {
+			continue
+		}
+		isCurrent[link] = true
+		if isFound[link] {
+			lines = append(lines, link)
+		} else {
+			removed = append(removed, link)
+		}
+	}
+	for _, link := range found {
+		if !isCurrent[link] {
+			added = append(added, link)
+		}
+	}
+	sort.Strings(added)
+	lines = append(lines, added...)
+	return lines, added, removed
+}
+
+func writeLines(path string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	var data []byte
+	for _, line := range lines {
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+	return util.WriteFileAtomic(path, data)
+}
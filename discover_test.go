@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeLinks(t *testing.T) {
+	current := []string{"https://a/3", "", "https://a/1", "https://a/gone", "https://a/1"}
+	found := []string{"https://a/new-b", "https://a/1", "https://a/new-a", "https://a/3"}
+	lines, added, removed := mergeLinks(current, found)
+
+	// Links still around keep their place, new ones go at the end sorted
+	if want := []string{"https://a/3", "https://a/1", "https://a/new-a", "https://a/new-b"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %v, want %v", lines, want)
+	}
+	if want := []string{"https://a/new-a", "https://a/new-b"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if want := []string{"https://a/gone"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+
+	if lines, added, removed := mergeLinks(found, found); !reflect.DeepEqual(lines, found) || len(added) != 0 || len(removed) != 0 {
+		t.Errorf("merging a file with itself = %v, +%v, -%v", lines, added, removed)
+	}
+}
@@ -1,11 +1,15 @@
 package cs2
 
 import (
-	"gocasesapi/log"
+	"errors"
+	"fmt"
+	"gocasesapi/multiscraper"
 	"gocasesapi/util"
+	"net/url"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	orderedmap "github.com/wk8/go-ordered-map/v2"
@@ -26,13 +30,16 @@ var (
 )
 
 // Scrape any container from its page
-func ScrapeContainer(mtx *sync.Mutex, doc *goquery.Document, result map[string]Container) {
-	formattedName := strings.TrimSpace(doc.Find("div.collapsed-top-margin > :nth-child(1)").Text())
+func ScrapeContainer(page *multiscraper.Page) ([]multiscraper.Keyed[Container], []error) {
+	formattedName := strings.TrimSpace(page.Find("div.collapsed-top-margin > :nth-child(1)").Text())
+	if formattedName == "" {
+		return nil, []error{errors.New("no container name found")}
+	}
 	unformattedName := util.RemoveNameFormatting(formattedName)
-	image := doc.Find(".content-header-img-margin")
+	image := page.Find(".content-header-img-margin")
 	imageUrl, exists := image.Attr("src")
 	if !exists {
-		log.Warning.Printf("No image url for %s\n", formattedName)
+		page.Warnf("No image url for %s", formattedName)
 	}
 
 	// Prefill item ordered map to ensure correct order of rarities
@@ -41,7 +48,7 @@ func ScrapeContainer(mtx *sync.Mutex, doc *goquery.Document, result map[string]C
 		items.Set(rarity, make([]string, 0))
 	}
 
-	itemBoxes := doc.Find("div.well.result-box.nomargin")
+	itemBoxes := page.Find("div.well.result-box.nomargin")
 	itemBoxes.Each(func(i int, box *goquery.Selection) {
 		qualityText := box.Find("div.quality").Text()
 		// if the box has no rarity text, must be an ad box or something else
@@ -60,6 +67,7 @@ func ScrapeContainer(mtx *sync.Mutex, doc *goquery.Document, result map[string]C
 		}
 
 		if !qualityFound {
+			page.Warnf("Unknown quality %q for an item in %s", qualityText, formattedName)
 			return
 		}
 
@@ -91,20 +99,26 @@ func ScrapeContainer(mtx *sync.Mutex, doc *goquery.Document, result map[string]C
 		}
 	}
 
-	mtx.Lock()
-	defer mtx.Unlock()
-	result[unformattedName] = Container{
-		FormattedName: formattedName,
-		ImageURL:      imageUrl,
-		Items:         items,
-		RequiresKey:   requiresKey,
-	}
+	return []multiscraper.Keyed[Container]{{
+		Key:  unformattedName,
+		Name: formattedName,
+		Item: Container{
+			FormattedName: formattedName,
+			ImageURL:      imageUrl,
+			Items:         items,
+			RequiresKey:   requiresKey,
+		},
+	}}, nil
 }
 
 // Scraping knives, gloves,
-func ScrapeSkinLink(mtx *sync.Mutex, doc *goquery.Document, result map[string]Skin) {
+func ScrapeSkinLink(page *multiscraper.Page) ([]multiscraper.Keyed[Skin], []error) {
 	// Get names
-	formattedName := strings.TrimSpace(doc.Find(".result-box > h2:nth-child(1)").Text())
+	formattedName := strings.TrimSpace(page.Find(".result-box > h2:nth-child(1)").Text())
+	if formattedName == "" {
+		return nil, []error{errors.New("no skin name found")}
+	}
+	var errs []error
 	unformattedName := util.RemoveNameFormatting(formattedName)
 
 	isVanillaKnife := strings.Contains(formattedName, "★ (Vanilla)")
@@ -134,16 +148,16 @@ func ScrapeSkinLink(mtx *sync.Mutex, doc *goquery.Document, result map[string]Sk
 		bestConditionIndex = 0
 
 		// Get our single skin image and inspect url
-		image := doc.Find(".main-skin-img")
+		image := page.Find(".main-skin-img")
 		imageURL, exists := image.Attr("src")
 		if !exists {
-			log.Warning.Printf("No image URL found for vanilla knife %s\n", formattedName)
+			page.Warnf("No image URL found for vanilla knife %s", formattedName)
 		}
 
-		inspectButton := doc.Find(".inspect-button-skin")
+		inspectButton := page.Find(".inspect-button-skin")
 		inspectUrl, exists := inspectButton.Attr("href")
 		if !exists {
-			log.Warning.Printf("No inspect URL found for vanilla knife %s\n", formattedName)
+			page.Warnf("No inspect URL found for vanilla knife %s", formattedName)
 		}
 
 		// Use that single image for all 5 conditions
@@ -153,59 +167,28 @@ func ScrapeSkinLink(mtx *sync.Mutex, doc *goquery.Document, result map[string]Sk
 		}
 	} else {
 		// Determine item rarity and weapon type
-		skinTypeString := strings.TrimSpace(doc.Find("div.quality").Text())
-		stattrakAvailable = doc.Find("div.stattrak").Length() > 0
-		souvenirAvailable = doc.Find("div.souvenir").Length() > 0
-		qualityFound := false
-		for _, quality := range util.Qualities {
-			if strings.Contains(skinTypeString, quality) {
-				selectedQuality = strings.ToLower(quality)
-				weaponType = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(skinTypeString, quality)))
-				qualityFound = true
-				break
-			}
-		}
-
+		skinTypeString := strings.TrimSpace(page.Find("div.quality").Text())
+		stattrakAvailable = page.Find("div.stattrak").Length() > 0
+		souvenirAvailable = page.Find("div.souvenir").Length() > 0
+		var qualityFound bool
+		selectedQuality, weaponType, qualityFound = findQuality(skinTypeString)
 		if !qualityFound {
-			return
+			return nil, []error{fmt.Errorf("no quality found for %s in %q", formattedName, skinTypeString)}
 		}
 
-		// Description and flavor text come from .misc-details-box
-		{
-			miscDetailsBox := doc.Find(".skin-misc-details")
-			pTags := miscDetailsBox.Find("p")
-
-			// Iterate over each p tag, try to find description
-			pTags.EachWithBreak(func(i int, tag *goquery.Selection) bool {
-				text := strings.TrimSpace(tag.Text())
-				if strings.Contains(text, "Description: ") {
-					description = strings.TrimPrefix(text, "Description: ")
-					return false
-				}
-				return true
-			})
-
-			// Iterate over each p tag, try to find flavor text
-			pTags.EachWithBreak(func(i int, tag *goquery.Selection) bool {
-				text := strings.TrimSpace(tag.Text())
-				if strings.Contains(text, "Flavor Text: ") {
-					flavorText = strings.TrimPrefix(text, "Flavor Text: ")
-					return false
-				}
-				return true
-			})
-		}
+		description = detailText(page.Document, "Description")
+		flavorText = detailText(page.Document, "Flavor Text")
 
 		// Get the min and max floats - keep them as strings for API
-		minFloatString = doc.Find("div.marker-wrapper:nth-child(1) > div:nth-child(1) > div:nth-child(1)").Text()
-		maxFloatString = doc.Find("div.marker-wrapper:nth-child(2) > div:nth-child(1) > div:nth-child(1)").Text()
+		minFloatString = page.Find("div.marker-wrapper:nth-child(1) > div:nth-child(1) > div:nth-child(1)").Text()
+		maxFloatString = page.Find("div.marker-wrapper:nth-child(2) > div:nth-child(1) > div:nth-child(1)").Text()
 
 		// We still need to convert the min and max float string to actual floats in order
 		// to determine the best and worst condition indices
 		{
 			minFloat64, err := strconv.ParseFloat(minFloatString, 32)
 			if err != nil {
-				log.Error.Println(err)
+				errs = append(errs, fmt.Errorf("could not parse float of %s: %w", formattedName, err))
 			}
 
 			minFloat = float32(minFloat64)
@@ -214,7 +197,7 @@ func ScrapeSkinLink(mtx *sync.Mutex, doc *goquery.Document, result map[string]Sk
 		{
 			maxFloat64, err := strconv.ParseFloat(maxFloatString, 32)
 			if err != nil {
-				log.Error.Println(err)
+				errs = append(errs, fmt.Errorf("could not parse float of %s: %w", formattedName, err))
 			}
 			maxFloat = float32(maxFloat64)
 		}
@@ -238,16 +221,16 @@ func ScrapeSkinLink(mtx *sync.Mutex, doc *goquery.Document, result map[string]Sk
 		}
 
 		// Get the image urls and inspect urls from the inspect buttons
-		mainBox := doc.Find("div.well.result-box.nomargin")
+		mainBox := page.Find("div.well.result-box.nomargin")
 		imageButtons := mainBox.Find("a.inspect-img-hover")
 		imageButtons.Each(func(i int, button *goquery.Selection) {
 			imageURL, exists := button.Attr("data-hoverimg")
 			if !exists {
-				log.Warning.Printf("No image URL found for weapon skin %s\n", formattedName)
+				page.Warnf("No image URL found for weapon skin %s", formattedName)
 			}
 			inspectUrl, exists := button.Attr("href")
 			if !exists {
-				log.Warning.Printf("No inspect URL found for weapon skin %s\n", formattedName)
+				page.Warnf("No inspect URL found for weapon skin %s", formattedName)
 			}
 			index := buttonTextIndexMap[strings.TrimSpace(button.Text())]
 			conditionImages[index] = imageURL
@@ -260,14 +243,14 @@ func ScrapeSkinLink(mtx *sync.Mutex, doc *goquery.Document, result map[string]Sk
 	// only knives and gloves can be found in multiple containers
 	// other skins can only be found in one case
 	if weaponType == "gloves" || weaponType == "knife" {
-		containersList := doc.Find("#knife-cases-collapse > div:nth-child(4)").Find("div")
+		containersList := page.Find("#knife-cases-collapse > div:nth-child(4)").Find("div")
 		containersList.Each(func(i int, s *goquery.Selection) {
 			containerFormattedName := strings.TrimSpace(s.Text())
 			containerUnformattedName := util.RemoveNameFormatting(containerFormattedName)
 			containersFoundIn = append(containersFoundIn, containerUnformattedName)
 		})
 	} else {
-		formattedContainerName := strings.TrimSpace(doc.Find("div.skin-details-collection-container-wrapper:nth-child(1)").Text())
+		formattedContainerName := strings.TrimSpace(page.Find("div.skin-details-collection-container-wrapper:nth-child(1)").Text())
 		unformattedContainerName := util.RemoveNameFormatting(formattedContainerName)
 		containersFoundIn = append(containersFoundIn, unformattedContainerName)
 	}
@@ -275,7 +258,7 @@ func ScrapeSkinLink(mtx *sync.Mutex, doc *goquery.Document, result map[string]Sk
 	// Now detect if the skin has any possible variations
 	variations := make(map[string]SkinVariation)
 	if isDoppler {
-		skinVariationWholeBox := doc.Find("#preview-variants > div:nth-child(1)")
+		skinVariationWholeBox := page.Find("#preview-variants > div:nth-child(1)")
 		skinBoxes := skinVariationWholeBox.Find("div.no-padding")
 		skinBoxes.Each(func(i int, box *goquery.Selection) {
 			dopplerFormattedName := box.Find("h3, h4").Text()
@@ -283,12 +266,12 @@ func ScrapeSkinLink(mtx *sync.Mutex, doc *goquery.Document, result map[string]Sk
 			dopplerImage := box.Find("img")
 			dopplerImageUrl, exists := dopplerImage.Attr("src")
 			if !exists {
-				log.Warning.Printf("No image URL found for doppler knife %s %s\n", formattedName, dopplerFormattedName)
+				page.Warnf("No image URL found for doppler knife %s %s", formattedName, dopplerFormattedName)
 			}
 			dopplerInspect := box.Find(".inspect-button-skin")
 			dopplerInspectUrl, exists := dopplerInspect.Attr("href")
 			if !exists {
-				log.Warning.Printf("No inspect URL found for doppler knife %s %s\n", formattedName, dopplerFormattedName)
+				page.Warnf("No inspect URL found for doppler knife %s %s", formattedName, dopplerFormattedName)
 			}
 			dopplerConditionImages := conditionImages
 			dopplerInspectUrls := inspectUrls
@@ -329,14 +312,14 @@ func ScrapeSkinLink(mtx *sync.Mutex, doc *goquery.Document, result map[string]Sk
 		Variations:          variations,
 	}
 
-	mtx.Lock()
-	defer mtx.Unlock()
-	result[unformattedName] = skinData
+	return []multiscraper.Keyed[Skin]{{Key: unformattedName, Name: formattedName, Item: skinData}}, errs
 }
 
 // Scrape page full of stickers, don't need to go into the page itself
-func ScrapeStickerPage(mtx *sync.Mutex, doc *goquery.Document, result map[string]Sticker) {
-	boxes := doc.Find("div.well.result-box.nomargin")
+func ScrapeStickerPage(page *multiscraper.Page) ([]multiscraper.Keyed[Sticker], []error) {
+	enqueueFollowingPages(page)
+	var stickers []multiscraper.Keyed[Sticker]
+	boxes := page.Find("div.well.result-box.nomargin")
 	boxes.Each(func(i int, box *goquery.Selection) {
 		formattedName := strings.TrimSpace(box.Find("h3").Text())
 
@@ -353,12 +336,12 @@ func ScrapeStickerPage(mtx *sync.Mutex, doc *goquery.Document, result map[string
 		image := box.Find("img")
 		imageUrl, exists := image.Attr("src")
 		if !exists {
-			log.Warning.Printf("No image url for sticker %s\n", formattedName)
+			page.Warnf("No image url for sticker %s", formattedName)
 		}
 		inspectButton := box.Find(".inspect-button-sticker")
 		inspectUrl, exists := inspectButton.Attr("href")
 		if !exists {
-			log.Warning.Printf("No inspect url for sticker %s\n", formattedName)
+			page.Warnf("No inspect url for sticker %s", formattedName)
 		}
 
 		rarityText := box.Find("div.quality").Text()
@@ -366,25 +349,102 @@ func ScrapeStickerPage(mtx *sync.Mutex, doc *goquery.Document, result map[string
 
 		container := util.RemoveNameFormatting(strings.TrimSpace(box.Find("p.item-resultbox-collection-container-info").Text()))
 
-		mtx.Lock()
-		defer mtx.Unlock()
-		result[unformattedName] = Sticker{
-			FormattedName:     formattedName,
-			Description:       "",
-			FlavorText:        "",
-			Quality:           rarity,
-			InspectURLs:       []string{inspectUrl},
-			ImageURLs:         []string{imageUrl},
-			StattrakAvailable: false,
-			SouvenirAvailable: false,
-			ContainersFoundIn: []string{container},
+		stickers = append(stickers, multiscraper.Keyed[Sticker]{
+			Key:  unformattedName,
+			Name: formattedName,
+			Item: Sticker{
+				FormattedName:     formattedName,
+				Description:       "",
+				FlavorText:        "",
+				Quality:           rarity,
+				InspectURLs:       []string{inspectUrl},
+				ImageURLs:         []string{imageUrl},
+				StattrakAvailable: false,
+				SouvenirAvailable: false,
+				ContainersFoundIn: []string{container},
+			},
+		})
+	})
+	return stickers, nil
+}
+
+// Scrape page full of patches, don't need to go into the page itself
+func ScrapePatchPage(page *multiscraper.Page) ([]multiscraper.Keyed[Patch], []error) {
+	enqueueFollowingPages(page)
+	var patches []multiscraper.Keyed[Patch]
+	for _, keyed := range scrapeItemBoxes(page, "patch") {
+		patches = append(patches, multiscraper.Keyed[Patch]{Key: keyed.Key, Name: keyed.Name, Item: Patch(keyed.Item)})
+	}
+	return patches, nil
+}
+
+// Scrape a patch pack, see ScrapeContainer
+func ScrapePatchPack(page *multiscraper.Page) ([]multiscraper.Keyed[PatchPack], []error) {
+	return scrapeListed(page, patchPackPath, func(page *multiscraper.Page) ([]multiscraper.Keyed[PatchPack], []error) {
+		containers, errs := ScrapeContainer(page)
+		var packs []multiscraper.Keyed[PatchPack]
+		for _, keyed := range containers {
+			packs = append(packs, multiscraper.Keyed[PatchPack]{Key: keyed.Key, Name: keyed.Name, Item: PatchPack(keyed.Item)})
 		}
+		return packs, errs
 	})
 }
 
+// Items in the result boxes of a listing whose boxes have all there is to know about them, such
+// as the patches. kind names the items in warnings
+func scrapeItemBoxes(page *multiscraper.Page, kind string) []multiscraper.Keyed[Item] {
+	var items []multiscraper.Keyed[Item]
+	page.Find("div.well.result-box.nomargin").Each(func(i int, box *goquery.Selection) {
+		formattedName := strings.TrimSpace(box.Find("h3").Text())
+		if formattedName == "" {
+			return
+		}
+		unformattedName := util.RemoveNameFormatting(formattedName)
+
+		qualityText := strings.TrimSpace(box.Find("div.quality").Text())
+		quality, _, ok := findQuality(qualityText)
+		if !ok {
+			page.Warnf("Unknown quality %q for %s %s", qualityText, kind, formattedName)
+			return
+		}
+		imageUrl, exists := box.Find("img").Attr("src")
+		if !exists {
+			page.Warnf("No image url for %s %s", kind, formattedName)
+		}
+		inspectUrl, exists := box.Find(`a[href^="steam://"]`).Attr("href")
+		if !exists {
+			page.Warnf("No inspect url for %s %s", kind, formattedName)
+		}
+
+		containers := []string{}
+		if container := strings.TrimSpace(box.Find("p.item-resultbox-collection-container-info").Text()); container != "" {
+			containers = append(containers, util.RemoveNameFormatting(container))
+		}
+
+		items = append(items, multiscraper.Keyed[Item]{
+			Key:  unformattedName,
+			Name: formattedName,
+			Item: Item{
+				FormattedName:     formattedName,
+				Description:       "",
+				FlavorText:        "",
+				Quality:           quality,
+				InspectURLs:       []string{inspectUrl},
+				ImageURLs:         []string{imageUrl},
+				StattrakAvailable: false,
+				SouvenirAvailable: false,
+				ContainersFoundIn: containers,
+			},
+		})
+	})
+	return items
+}
+
 // Scrape page full of souvenir packages, don't need to go into the page itself
-func ScrapeSouvenirPackagePage(mtx *sync.Mutex, doc *goquery.Document, result map[string]SouvenirPackage) {
-	boxes := doc.Find("div.well.result-box.nomargin")
+func ScrapeSouvenirPackagePage(page *multiscraper.Page) ([]multiscraper.Keyed[SouvenirPackage], []error) {
+	enqueueFollowingPages(page)
+	var packages []multiscraper.Keyed[SouvenirPackage]
+	boxes := page.Find("div.well.result-box.nomargin")
 	boxes.Each(func(i int, box *goquery.Selection) {
 		formattedName := strings.TrimSpace(box.Find("h4").Text())
 		if formattedName == "" {
@@ -394,17 +454,337 @@ func ScrapeSouvenirPackagePage(mtx *sync.Mutex, doc *goquery.Document, result ma
 		image := box.Find("img:nth-child(2)")
 		imageUrl, exists := image.Attr("src")
 		if !exists {
-			log.Warning.Printf("No image url for souvenir package %s\n", formattedName)
+			page.Warnf("No image url for souvenir package %s", formattedName)
 		}
 
 		collection := util.RemoveNameFormatting(box.Find("div:nth-child(1) > div:nth-child(3)").Text())
 
-		mtx.Lock()
-		defer mtx.Unlock()
-		result[unformattedName] = SouvenirPackage{
-			FormattedName: formattedName,
-			ImageURL:      imageUrl,
-			Collection:    collection,
+		packages = append(packages, multiscraper.Keyed[SouvenirPackage]{
+			Key:  unformattedName,
+			Name: formattedName,
+			Item: SouvenirPackage{
+				FormattedName: formattedName,
+				ImageURL:      imageUrl,
+				Collection:    collection,
+			},
+		})
+	})
+	return packages, nil
+}
+
+// Scrape an agent with its faction
+func ScrapeAgent(page *multiscraper.Page) ([]multiscraper.Keyed[Agent], []error) {
+	return scrapeListed(page, agentPath, func(page *multiscraper.Page) ([]multiscraper.Keyed[Agent], []error) {
+		return scrapeItemPage(page, agentPage)
+	})
+}
+
+// Faction of an agent by the team its page names
+var agentFactions = map[string]string{
+	"Counter-Terrorist": "ct",
+	"Terrorist":         "t",
+}
+
+var agentPage = itemPage[Agent]{
+	kind:          "agent",
+	inspectButton: ".inspect-button-skin",
+	build: func(page *multiscraper.Page, item Item) (Agent, error) {
+		// Read from its own line of the details, other text on the page such as the
+		// description can name either side
+		team := detailText(page.Document, "Team")
+		faction, ok := agentFactions[team]
+		if !ok {
+			return Agent{}, fmt.Errorf("no faction found for agent %s in %q", item.FormattedName, team)
+		}
+		return Agent{Item: item, Faction: faction}, nil
+	},
+}
+
+// Scrape a music kit with its artist and audio previews
+func ScrapeMusicKit(page *multiscraper.Page) ([]multiscraper.Keyed[MusicKit], []error) {
+	return scrapeListed(page, musicKitPath, func(page *multiscraper.Page) ([]multiscraper.Keyed[MusicKit], []error) {
+		return scrapeItemPage(page, musicKitPage)
+	})
+}
+
+// Scrape a music kit box, StatTrak or not, into the same shape ScrapeContainer gives cases
+func ScrapeMusicKitBox(page *multiscraper.Page) ([]multiscraper.Keyed[Container], []error) {
+	return scrapeListed(page, casePath, ScrapeContainer)
+}
+
+// Music kits can't be inspected
+var musicKitPage = itemPage[MusicKit]{
+	kind:       "music kit",
+	namePrefix: "Music Kit | ",
+	build: func(page *multiscraper.Page, item Item) (MusicKit, error) {
+		item.StattrakAvailable = page.Find("div.stattrak").Length() > 0
+
+		// Kits are named "Artist, Kit"
+		artist, _, found := strings.Cut(item.FormattedName, ", ")
+		if !found {
+			artist = ""
+			page.Warnf("No artist found for music kit %s", item.FormattedName)
+		}
+
+		// Every track has its own player, labelled with what the track plays for
+		audioUrls := make(map[string]string)
+		page.Find("audio").Each(func(i int, audio *goquery.Selection) {
+			audioUrl, exists := audio.Attr("src")
+			if !exists {
+				audioUrl, exists = audio.Find("source").Attr("src")
+			}
+			if !exists {
+				return
+			}
+			track := util.RemoveNameFormatting(audio.Parent().Find("h3, h4, h5").First().Text())
+			if track == "" {
+				// Fall back to the file name, which names the track too
+				track = strings.TrimSuffix(path.Base(audioUrl), path.Ext(audioUrl))
+			}
+			audioUrls[track] = audioUrl
+		})
+		if len(audioUrls) == 0 {
+			page.Warnf("No audio previews for music kit %s", item.FormattedName)
+		}
+		return MusicKit{Item: item, Artist: artist, AudioURLs: audioUrls}, nil
+	},
+}
+
+// Scrape a sealed graffiti along with every color it comes in
+func ScrapeGraffiti(page *multiscraper.Page) ([]multiscraper.Keyed[Graffiti], []error) {
+	return scrapeListed(page, graffitiPath, func(page *multiscraper.Page) ([]multiscraper.Keyed[Graffiti], []error) {
+		return scrapeItemPage(page, graffitiPage)
+	})
+}
+
+var graffitiPage = itemPage[Graffiti]{
+	kind:          "graffiti",
+	namePrefix:    "Sealed Graffiti | ",
+	inspectButton: `a[href^="steam://"]`,
+	build: func(page *multiscraper.Page, item Item) (Graffiti, error) {
+		// Single color graffiti come in a handful of colors, each with its own image and
+		// inspect link, multicolored ones have none
+		colorVariations := make(map[string]GraffitiColorVariation)
+		page.Find("#preview-variants div.no-padding").Each(func(i int, box *goquery.Selection) {
+			colorFormattedName := strings.TrimSpace(box.Find("h3, h4").First().Text())
+			if colorFormattedName == "" {
+				return
+			}
+			colorImageUrl, exists := box.Find("img").Attr("src")
+			if !exists {
+				page.Warnf("No image url for graffiti %s in %s", item.FormattedName, colorFormattedName)
+			}
+			colorInspectUrl, exists := box.Find(`a[href^="steam://"]`).Attr("href")
+			if !exists {
+				page.Warnf("No inspect url for graffiti %s in %s", item.FormattedName, colorFormattedName)
+			}
+			colorVariations[util.RemoveNameFormatting(colorFormattedName)] = GraffitiColorVariation{
+				ImageUrl:   colorImageUrl,
+				InspectUrl: colorInspectUrl,
+			}
+		})
+		return Graffiti{Item: item, ColorVarations: colorVariations}, nil
+	},
+}
+
+// Scrape a pin
+func ScrapePin(page *multiscraper.Page) ([]multiscraper.Keyed[Pin], []error) {
+	return scrapeListed(page, pinPath, func(page *multiscraper.Page) ([]multiscraper.Keyed[Pin], []error) {
+		return scrapeItemPage(page, pinPage)
+	})
+}
+
+// Scrape a pin capsule, see ScrapeContainer
+func ScrapePinCapsule(page *multiscraper.Page) ([]multiscraper.Keyed[PinCapsule], []error) {
+	return scrapeListed(page, pinCapsulePath, func(page *multiscraper.Page) ([]multiscraper.Keyed[PinCapsule], []error) {
+		containers, errs := ScrapeContainer(page)
+		var capsules []multiscraper.Keyed[PinCapsule]
+		for _, keyed := range containers {
+			capsules = append(capsules, multiscraper.Keyed[PinCapsule]{Key: keyed.Key, Name: keyed.Name, Item: PinCapsule(keyed.Item)})
 		}
+		return capsules, errs
 	})
 }
+
+var pinPage = itemPage[Pin]{
+	kind:          "pin",
+	namePrefix:    "Pin | ",
+	inspectButton: `a[href^="steam://"]`,
+	build: func(page *multiscraper.Page, item Item) (Pin, error) {
+		return Pin(item), nil
+	},
+}
+
+// What sets the kinds of items with a page of their own apart. Everything else on the page is
+// read the same way for all of them
+type itemPage[T any] struct {
+	// Names the item in errors and warnings
+	kind string
+	// Cut from the front of the name in the heading, such as "Pin | "
+	namePrefix string
+	// Link to inspect the item in game, "" for items that can't be inspected
+	inspectButton string
+	// Builds the item from what every item page has, an error fails the page
+	build func(page *multiscraper.Page, item Item) (T, error)
+}
+
+// Scrape the item on an item page, see itemPage
+func scrapeItemPage[T any](page *multiscraper.Page, kind itemPage[T]) ([]multiscraper.Keyed[T], []error) {
+	formattedName := strings.TrimSpace(page.Find(".result-box > h2:nth-child(1)").Text())
+	formattedName = strings.TrimSpace(strings.TrimPrefix(formattedName, kind.namePrefix))
+	if formattedName == "" {
+		return nil, []error{fmt.Errorf("no %s name found", kind.kind)}
+	}
+	unformattedName := util.RemoveNameFormatting(formattedName)
+
+	qualityText := strings.TrimSpace(page.Find("div.quality").Text())
+	quality, _, ok := findQuality(qualityText)
+	if !ok {
+		return nil, []error{fmt.Errorf("no quality found for %s in %q", formattedName, qualityText)}
+	}
+
+	imageUrl, exists := page.Find(".main-skin-img").Attr("src")
+	if !exists {
+		page.Warnf("No image url for %s %s", kind.kind, formattedName)
+	}
+	inspectUrls := []string{}
+	if kind.inspectButton != "" {
+		inspectUrl, exists := page.Find(kind.inspectButton).Attr("href")
+		if !exists {
+			page.Warnf("No inspect url for %s %s", kind.kind, formattedName)
+		}
+		inspectUrls = append(inspectUrls, inspectUrl)
+	}
+
+	item, err := kind.build(page, Item{
+		FormattedName:     formattedName,
+		Description:       detailText(page.Document, "Description"),
+		FlavorText:        detailText(page.Document, "Flavor Text"),
+		Quality:           quality,
+		InspectURLs:       inspectUrls,
+		ImageURLs:         []string{imageUrl},
+		StattrakAvailable: false,
+		SouvenirAvailable: false,
+		// The collection, operation, capsules or boxes the item comes from
+		ContainersFoundIn: containersFoundIn(page.Document),
+	})
+	if err != nil {
+		return nil, []error{err}
+	}
+	return []multiscraper.Keyed[T]{{
+		Key:  unformattedName,
+		Name: formattedName,
+		Item: item,
+	}}, nil
+}
+
+// Scrape the item pages a listing links to. Pages whose path matches itemPath are items and
+// go to scrapeItem, any other page is taken as a listing and its item pages and following
+// pages are queued. This is how the Scrape funcs for items with pages of their own get by with
+// only the listings in their links file
+func scrapeListed[T any](page *multiscraper.Page, itemPath *regexp.Regexp, scrapeItem func(*multiscraper.Page) ([]multiscraper.Keyed[T], []error)) ([]multiscraper.Keyed[T], []error) {
+	if page.Url != nil && !itemPath.MatchString(page.Url.Path) {
+		enqueueFollowingPages(page)
+		enqueueLinks(page, itemPath)
+		return nil, nil
+	}
+	return scrapeItem(page)
+}
+
+// Containers an item page says the item comes in, unformatted
+func containersFoundIn(doc *goquery.Document) []string {
+	containers := []string{}
+	doc.Find("div.skin-details-collection-container-wrapper").Each(func(i int, wrapper *goquery.Selection) {
+		if container := strings.TrimSpace(wrapper.Text()); container != "" {
+			containers = append(containers, util.RemoveNameFormatting(container))
+		}
+	})
+	return containers
+}
+
+// Quality named in text, lowercased, along with what follows it, such as "covert" and "knife"
+// for "Covert Knife"
+func findQuality(text string) (quality string, rest string, ok bool) {
+	for _, quality := range util.Qualities {
+		if strings.Contains(text, quality) {
+			rest = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(text, quality)))
+			return strings.ToLower(quality), rest, true
+		}
+	}
+	return "", "", false
+}
+
+// Text of the "label: " paragraph in the details box of an item page, "" when there is none
+func detailText(doc *goquery.Document, label string) string {
+	text := ""
+	doc.Find(".skin-misc-details p").EachWithBreak(func(i int, tag *goquery.Selection) bool {
+		tagText := strings.TrimSpace(tag.Text())
+		if strings.Contains(tagText, label+": ") {
+			text = strings.TrimPrefix(tagText, label+": ")
+			return false
+		}
+		return true
+	})
+	return text
+}
+
+// Queue every page on the site whose path matches pattern that the result boxes of a listing
+// link to. Links elsewhere on the page, such as the menus or the related items in the sidebar,
+// are not part of the listing
+func enqueueLinks(page *multiscraper.Page, pattern *regexp.Regexp) {
+	if page.Url == nil {
+		return
+	}
+	var links []string
+	page.Find("div.result-box a[href]").Each(func(i int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		link, err := page.Url.Parse(href)
+		if err != nil || link.Host != page.Url.Host || !pattern.MatchString(link.Path) {
+			return
+		}
+		link.RawQuery = ""
+		link.Fragment = ""
+		links = append(links, link.String())
+	})
+	page.Enqueue(links...)
+}
+
+// Queue the pages of a listing that come after the one being scraped, so the links file only
+// needs the first page. The highest page linked from the pagination control is taken as the
+// last page, and every page does this so a control only showing nearby pages still works
+func enqueueFollowingPages(page *multiscraper.Page) {
+	if page.Url == nil {
+		return
+	}
+	current := pageNumber(page.Url)
+	last := current
+	page.Find("ul.pagination a[href]").Each(func(i int, link *goquery.Selection) {
+		href, _ := link.Attr("href")
+		linked, err := page.Url.Parse(href)
+		if err != nil || linked.Path != page.Url.Path {
+			return
+		}
+		if number := pageNumber(linked); number > last {
+			last = number
+		}
+	})
+
+	var pages []string
+	for number := current + 1; number <= last; number++ {
+		pageUrl := *page.Url
+		query := pageUrl.Query()
+		query.Set("page", strconv.Itoa(number))
+		pageUrl.RawQuery = query.Encode()
+		pages = append(pages, pageUrl.String())
+	}
+	page.Enqueue(pages...)
+}
+
+// Page number in the query of a listing url, listings start at page 1
+func pageNumber(pageUrl *url.URL) int {
+	page, err := strconv.Atoi(pageUrl.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
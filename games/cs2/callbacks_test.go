@@ -0,0 +1,586 @@
+package cs2
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gocasesapi/multiscraper"
+
+	"github.com/PuerkitoBio/goquery"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+func parseHTML(t *testing.T, html string) *multiscraper.Page {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return multiscraper.NewPage(doc)
+}
+
+// Page for html as if it was fetched from pageUrl, so links on it can be resolved
+func parsePage(t *testing.T, pageUrl string, html string) *multiscraper.Page {
+	t.Helper()
+	page := parseHTML(t, html)
+	var err error
+	page.Url, err = url.Parse(pageUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+// Items are compared as json, which is what ends up in the output files and sees through the
+// ordered maps
+func sameJSON(t *testing.T, got any, want any) {
+	t.Helper()
+	gotJSON, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("got  %s\nwant %s", gotJSON, wantJSON)
+	}
+}
+
+func itemsByQuality(pairs ...any) *orderedmap.OrderedMap[string, []string] {
+	items := orderedmap.New[string, []string]()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		items.Set(pairs[i].(string), pairs[i+1].([]string))
+	}
+	return items
+}
+
+func TestScrapeContainer(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		want    []multiscraper.Keyed[Container]
+		wantErr bool
+	}{
+		{
+			name: "case needing a key",
+			html: `<div class="collapsed-top-margin"><h1>Chroma 2 Case</h1></div>
+<img class="content-header-img-margin" src="https://img.example/chroma2.png">
+<div class="well result-box nomargin"><h3>M4A1-S</h3><h4>Hyper Beast</h4><div class="quality">Covert Rifle</div></div>
+<div class="well result-box nomargin"><h3>MAC-10</h3><h4>Neon Rider</h4><div class="quality">Covert SMG</div></div>
+<div class="well result-box nomargin"><h3>AWP</h3><h4>Worm God</h4><div class="quality">Mil-Spec Sniper Rifle</div></div>
+<div class="well result-box nomargin"><h3>Ad</h3></div>`,
+			want: []multiscraper.Keyed[Container]{{
+				Key:  "chroma 2 case",
+				Name: "Chroma 2 Case",
+				Item: Container{
+					FormattedName: "Chroma 2 Case",
+					ImageURL:      "https://img.example/chroma2.png",
+					// In the order of util.Qualities, not of the page
+					Items: itemsByQuality(
+						"mil-spec", []string{"awp worm god"},
+						"covert", []string{"m4a1s hyper beast", "mac10 neon rider"},
+					),
+					RequiresKey: true,
+				},
+			}},
+		},
+		{
+			name: "collection",
+			html: `<div class="collapsed-top-margin"><h1>The Dust 2 Collection</h1></div>
+<img class="content-header-img-margin" src="https://img.example/dust2.png">
+<div class="well result-box nomargin"><h3>P250</h3><h4>Sand Dune</h4><div class="quality">Consumer Grade Pistol</div></div>
+<div class="well result-box nomargin"><h3>Glock-18</h3><h4>Strange</h4><div class="quality">Unheard Of Pistol</div></div>`,
+			want: []multiscraper.Keyed[Container]{{
+				Key:  "the dust 2 collection",
+				Name: "The Dust 2 Collection",
+				Item: Container{
+					FormattedName: "The Dust 2 Collection",
+					ImageURL:      "https://img.example/dust2.png",
+					Items:         itemsByQuality("consumer grade", []string{"p250 sand dune"}),
+				},
+			}},
+		},
+		{
+			name:    "no name",
+			html:    `<div class="well result-box nomargin"><h3>P250</h3><div class="quality">Consumer Grade Pistol</div></div>`,
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, errs := ScrapeContainer(parseHTML(t, test.html))
+			if test.wantErr != (len(errs) > 0) {
+				t.Fatalf("errors = %v, want errors: %t", errs, test.wantErr)
+			}
+			sameJSON(t, got, test.want)
+		})
+	}
+}
+
+const skinPage = `<div class="well result-box nomargin">
+<h2>AK-47 | Redline</h2>
+<div class="quality">Classified Rifle</div>
+<div class="stattrak">StatTrak Available</div>
+<div class="float-bar">
+	<div class="marker-wrapper"><div><div>%s</div></div></div>
+	<div class="marker-wrapper"><div><div>0.70</div></div></div>
+</div>
+<a class="inspect-img-hover" data-hoverimg="https://img.example/redline-mw.png" href="steam://inspect/mw">Inspect (MW)</a>
+<a class="inspect-img-hover" data-hoverimg="https://img.example/redline-bs.png" href="steam://inspect/bs">Inspect (BS)</a>
+</div>
+<div class="skin-misc-details">
+	<p><strong>Description: </strong>It has been painted using a carbon fiber hydrographic.</p>
+	<p><strong>Flavor Text: </strong>Truly a red letter day</p>
+</div>
+<div><div class="skin-details-collection-container-wrapper">The Phoenix Collection</div></div>`
+
+func TestScrapeSkinLink(t *testing.T) {
+	redline := Skin{
+		Item: Item{
+			FormattedName:     "AK-47 | Redline",
+			Description:       "It has been painted using a carbon fiber hydrographic.",
+			FlavorText:        "Truly a red letter day",
+			Quality:           "classified",
+			InspectURLs:       []string{"", "steam://inspect/mw", "", "", "steam://inspect/bs"},
+			ImageURLs:         []string{"", "https://img.example/redline-mw.png", "", "", "https://img.example/redline-bs.png"},
+			StattrakAvailable: true,
+			ContainersFoundIn: []string{"the phoenix collection"},
+		},
+		WeaponType:          "rifle",
+		MinFloat:            "0.10",
+		MaxFloat:            "0.70",
+		WorstConditionIndex: 4,
+		BestConditionIndex:  1,
+		Variations:          map[string]SkinVariation{},
+	}
+	unparsedFloat := redline
+	unparsedFloat.MinFloat = "low"
+	// The float is taken as 0, so the best condition falls back to factory new
+	unparsedFloat.BestConditionIndex = 0
+
+	vanillaImages := []string{"https://img.example/karambit.png", "https://img.example/karambit.png", "https://img.example/karambit.png", "https://img.example/karambit.png", "https://img.example/karambit.png"}
+	vanillaInspects := []string{"steam://inspect/karambit", "steam://inspect/karambit", "steam://inspect/karambit", "steam://inspect/karambit", "steam://inspect/karambit"}
+
+	tests := []struct {
+		name     string
+		html     string
+		want     []multiscraper.Keyed[Skin]
+		wantErrs int
+	}{
+		{
+			name: "weapon skin",
+			html: strings.Replace(skinPage, "%s", "0.10", 1),
+			want: []multiscraper.Keyed[Skin]{{Key: "ak47 redline", Name: "AK-47 | Redline", Item: redline}},
+		},
+		{
+			name:     "float that does not parse",
+			html:     strings.Replace(skinPage, "%s", "low", 1),
+			want:     []multiscraper.Keyed[Skin]{{Key: "ak47 redline", Name: "AK-47 | Redline", Item: unparsedFloat}},
+			wantErrs: 1,
+		},
+		{
+			name: "vanilla knife",
+			html: `<div class="well result-box nomargin"><h2>★ Karambit ★ (Vanilla)</h2></div>
+<img class="main-skin-img" src="https://img.example/karambit.png">
+<a class="inspect-button-skin" href="steam://inspect/karambit">Inspect</a>
+<div id="knife-cases-collapse"><p></p><p></p><p></p><div><div>Chroma Case</div><div>Gamma Case</div></div></div>`,
+			want: []multiscraper.Keyed[Skin]{{
+				Key:  "karambit vanilla",
+				Name: "★ Karambit ★ (Vanilla)",
+				Item: Skin{
+					Item: Item{
+						FormattedName:     "★ Karambit ★ (Vanilla)",
+						Quality:           "covert",
+						InspectURLs:       vanillaInspects,
+						ImageURLs:         vanillaImages,
+						StattrakAvailable: true,
+						ContainersFoundIn: []string{"chroma case", "gamma case"},
+					},
+					WeaponType:          "knife",
+					MinFloat:            "0.00",
+					MaxFloat:            "1.00",
+					WorstConditionIndex: 4,
+					BestConditionIndex:  0,
+					Variations:          map[string]SkinVariation{},
+				},
+			}},
+		},
+		{
+			name:     "unknown quality",
+			html:     strings.Replace(strings.Replace(skinPage, "%s", "0.10", 1), "Classified Rifle", "Legendary Rifle", 1),
+			wantErrs: 1,
+		},
+		{
+			name:     "no name",
+			html:     `<div class="well result-box nomargin"><div class="quality">Classified Rifle</div></div>`,
+			wantErrs: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, errs := ScrapeSkinLink(parseHTML(t, test.html))
+			if len(errs) != test.wantErrs {
+				t.Fatalf("errors = %v, want %d", errs, test.wantErrs)
+			}
+			sameJSON(t, got, test.want)
+		})
+	}
+}
+
+func TestScrapeStickerPage(t *testing.T) {
+	html := `<div class="well result-box nomargin">
+	<h3>Titan (Holo)</h3><h4>Katowice 2014</h4>
+	<div class="quality">Exotic Sticker</div>
+	<img src="https://img.example/titan-holo.png">
+	<a class="inspect-button-sticker" href="steam://inspect/titan">Inspect</a>
+	<p class="item-resultbox-collection-container-info">EMS Katowice 2014 Legends</p>
+</div>
+<div class="well result-box nomargin">
+	<h3>Crown (Foil)</h3>
+	<div class="quality">Extraordinary Sticker</div>
+	<img src="https://img.example/crown.png">
+	<p class="item-resultbox-collection-container-info">Sticker Capsule</p>
+</div>
+<div class="well result-box nomargin"><div class="ad">Advert</div></div>`
+	want := []multiscraper.Keyed[Sticker]{
+		{
+			Key:  "titan holo katowice 2014",
+			Name: "Titan (Holo) | Katowice 2014",
+			Item: Sticker{
+				FormattedName:     "Titan (Holo) | Katowice 2014",
+				Quality:           "exotic",
+				InspectURLs:       []string{"steam://inspect/titan"},
+				ImageURLs:         []string{"https://img.example/titan-holo.png"},
+				ContainersFoundIn: []string{"ems katowice 2014 legends"},
+			},
+		},
+		{
+			Key:  "crown foil",
+			Name: "Crown (Foil)",
+			Item: Sticker{
+				FormattedName: "Crown (Foil)",
+				Quality:       "extraordinary",
+				// A missing inspect button leaves the url empty rather than dropping the sticker
+				InspectURLs:       []string{""},
+				ImageURLs:         []string{"https://img.example/crown.png"},
+				ContainersFoundIn: []string{"sticker capsule"},
+			},
+		},
+	}
+	got, errs := ScrapeStickerPage(parseHTML(t, html))
+	if len(errs) != 0 {
+		t.Fatalf("errors = %v", errs)
+	}
+	sameJSON(t, got, want)
+}
+
+func TestScrapeAgentFaction(t *testing.T) {
+	page := `<div class="well result-box nomargin">
+	<h2>Sir Bloody Darryl The Strapped | The Professionals</h2>
+	<div class="quality">Master Agent</div>
+</div>
+<div class="skin-misc-details">
+	<p><strong>Description: </strong>Once a Counter-Terrorist himself, Darryl now works for the other side.</p>
+	%s
+</div>`
+	tests := []struct {
+		name    string
+		team    string
+		want    string
+		wantErr bool
+	}{
+		{"terrorist", `<p><strong>Team: </strong>Terrorist</p>`, "t", false},
+		{"counter-terrorist", `<p><strong>Team: </strong>Counter-Terrorist</p>`, "ct", false},
+		// The description names a side, but that is not where the faction comes from
+		{"no team", ``, "", true},
+		{"unknown team", `<p><strong>Team: </strong>Spectator</p>`, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, errs := ScrapeAgent(parseHTML(t, strings.Replace(page, "%s", test.team, 1)))
+			if test.wantErr {
+				if len(errs) == 0 || len(got) != 0 {
+					t.Errorf("got %v, %v, want an error and no agent", got, errs)
+				}
+				return
+			}
+			if len(errs) != 0 || len(got) != 1 {
+				t.Fatalf("got %v, %v", got, errs)
+			}
+			if got[0].Item.Faction != test.want || got[0].Item.Quality != "master" {
+				t.Errorf("faction %q and quality %q, want %q and master", got[0].Item.Faction, got[0].Item.Quality, test.want)
+			}
+		})
+	}
+}
+
+func TestListingOnlyQueuesResultBoxes(t *testing.T) {
+	listing := `<nav><a href="/agent/9/menu-agent">Featured agent</a></nav>
+<div class="well result-box nomargin"><a href="/agent/1/darryl"><h3>Sir Bloody Darryl</h3></a></div>
+<div class="well result-box nomargin"><a href="https://other.example/agent/2/elsewhere">Elsewhere</a></div>
+<aside><a href="/agent/8/sidebar-agent">Related</a></aside>`
+	agent := `<div class="well result-box nomargin"><h2>Sir Bloody Darryl</h2><div class="quality">Master Agent</div></div>
+<div class="skin-misc-details"><p><strong>Team: </strong>Terrorist</p></div>
+<aside><a href="/agent/7/related">Related</a></aside>`
+	opts := multiscraper.DefaultOptions
+	opts.Fetcher = multiscraper.NewMapFetcher(map[string]string{
+		"https://csgostash.example/agents":         listing,
+		"https://csgostash.example/agent/1/darryl": agent,
+	})
+	result := make(map[string]Agent)
+	run := multiscraper.MultiScrape[Agent](context.Background(), []string{"https://csgostash.example/agents"}, result, opts, multiscraper.ScraperFunc[Agent](ScrapeAgent))
+
+	var scraped []string
+	for _, urlResult := range run.URLs {
+		scraped = append(scraped, urlResult.URL)
+	}
+	want := []string{"https://csgostash.example/agents", "https://csgostash.example/agent/1/darryl"}
+	if strings.Join(scraped, " ") != strings.Join(want, " ") {
+		t.Errorf("scraped %v, want %v", scraped, want)
+	}
+	if _, ok := result["sir bloody darryl"]; !ok || len(result) != 1 {
+		t.Errorf("result = %v, want only darryl", result)
+	}
+}
+
+func TestEnqueueFollowingPages(t *testing.T) {
+	// The control only shows pages near the current one
+	pagination := `<ul class="pagination">
+<li><a href="/stickers/regular?page=1">1</a></li>
+<li><a href="?page=3">3</a></li>
+<li><a href="https://csgostash.example/stickers/regular?page=4&sort=name">4</a></li>
+<li><a href="/stickers/other?page=9">9</a></li>
+</ul>`
+	tests := []struct {
+		name    string
+		pageUrl string
+		want    []string
+	}{
+		{
+			"first page without a page number",
+			"https://csgostash.example/stickers/regular",
+			[]string{"https://csgostash.example/stickers/regular?page=2", "https://csgostash.example/stickers/regular?page=3", "https://csgostash.example/stickers/regular?page=4"},
+		},
+		{
+			"middle page",
+			"https://csgostash.example/stickers/regular?page=2",
+			[]string{"https://csgostash.example/stickers/regular?page=3", "https://csgostash.example/stickers/regular?page=4"},
+		},
+		{"last page", "https://csgostash.example/stickers/regular?page=4", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page := parsePage(t, test.pageUrl, pagination)
+			enqueueFollowingPages(page)
+			if got := page.Links(); strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("queued %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	// Pages that are not listings have nothing to queue
+	page := parsePage(t, "https://csgostash.example/sticker/1/crown", `<h1>Crown</h1>`)
+	enqueueFollowingPages(page)
+	if len(page.Links()) != 0 {
+		t.Errorf("queued %v from a page without pagination", page.Links())
+	}
+}
+
+func TestScrapeMusicKit(t *testing.T) {
+	page := parsePage(t, "https://csgostash.example/music/12/daniel-sadowski-crimson-assault", `<div class="well result-box nomargin">
+	<h2>Music Kit | Daniel Sadowski, Crimson Assault</h2>
+	<div class="quality">High Grade Music Kit</div>
+	<div class="stattrak">StatTrak Available</div>
+	<img class="main-skin-img" src="https://img.example/crimson-assault.png">
+</div>
+<div class="skin-misc-details">
+	<p><strong>Description: </strong>Fight your way through.</p>
+</div>
+<div><h4>Main Menu</h4><audio src="https://audio.example/crimson/mainmenu.mp3"></audio></div>
+<div><audio><source src="https://audio.example/crimson/roundmvpanthem.mp3"></audio></div>
+<div><div class="skin-details-collection-container-wrapper">StatTrak&trade; Music Kit Box</div></div>`)
+	got, errs := ScrapeMusicKit(page)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	want := []multiscraper.Keyed[MusicKit]{{
+		Key:  "daniel sadowski crimson assault",
+		Name: "Daniel Sadowski, Crimson Assault",
+		Item: MusicKit{
+			Item: Item{
+				FormattedName:     "Daniel Sadowski, Crimson Assault",
+				Description:       "Fight your way through.",
+				Quality:           "high grade",
+				InspectURLs:       []string{},
+				ImageURLs:         []string{"https://img.example/crimson-assault.png"},
+				StattrakAvailable: true,
+				ContainersFoundIn: []string{"stattrak music kit box"},
+			},
+			Artist: "Daniel Sadowski",
+			// A player without a heading is named by its file
+			AudioURLs: map[string]string{
+				"main menu":      "https://audio.example/crimson/mainmenu.mp3",
+				"roundmvpanthem": "https://audio.example/crimson/roundmvpanthem.mp3",
+			},
+		},
+	}}
+	sameJSON(t, got, want)
+	if warnings := page.Warnings(); len(warnings) != 0 {
+		t.Errorf("warnings = %v", warnings)
+	}
+}
+
+func TestScrapeMusicKitBox(t *testing.T) {
+	page := parsePage(t, "https://csgostash.example/case/76/music-kit-box", `<div class="collapsed-top-margin"><h1>Music Kit Box</h1></div>
+<img class="content-header-img-margin" src="https://img.example/music-kit-box.png">
+<div class="well result-box nomargin"><h3>Daniel Sadowski</h3><h4>Crimson Assault</h4><div class="quality">High Grade Music Kit</div></div>`)
+	got, errs := ScrapeMusicKitBox(page)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	want := []multiscraper.Keyed[Container]{{
+		Key:  "music kit box",
+		Name: "Music Kit Box",
+		Item: Container{
+			FormattedName: "Music Kit Box",
+			ImageURL:      "https://img.example/music-kit-box.png",
+			Items:         itemsByQuality("high grade", []string{"daniel sadowski crimson assault"}),
+		},
+	}}
+	sameJSON(t, got, want)
+}
+
+func TestScrapeGraffiti(t *testing.T) {
+	page := parsePage(t, "https://csgostash.example/graffiti/5/sealed-graffiti-recoil-ak47", `<div class="well result-box nomargin">
+	<h2>Sealed Graffiti | Recoil AK-47</h2>
+	<div class="quality">Base Grade Graffiti</div>
+	<img class="main-skin-img" src="https://img.example/recoil-ak47.png">
+	<a href="steam://inspect/recoil-ak47">Inspect</a>
+</div>
+<div class="skin-misc-details">
+	<p><strong>Flavor Text: </strong>Spray and pray</p>
+</div>
+<div id="preview-variants">
+	<div class="no-padding"><h4>Shark White</h4><img src="https://img.example/recoil-white.png"><a href="steam://inspect/recoil-white">Inspect</a></div>
+	<div class="no-padding"><h4>Tiger Orange</h4><img src="https://img.example/recoil-orange.png"></div>
+</div>
+<div><div class="skin-details-collection-container-wrapper">Community Graffiti Box 1</div></div>`)
+	got, errs := ScrapeGraffiti(page)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	want := []multiscraper.Keyed[Graffiti]{{
+		Key:  "recoil ak47",
+		Name: "Recoil AK-47",
+		Item: Graffiti{
+			Item: Item{
+				FormattedName:     "Recoil AK-47",
+				FlavorText:        "Spray and pray",
+				Quality:           "base grade",
+				InspectURLs:       []string{"steam://inspect/recoil-ak47"},
+				ImageURLs:         []string{"https://img.example/recoil-ak47.png"},
+				ContainersFoundIn: []string{"community graffiti box 1"},
+			},
+			ColorVarations: map[string]GraffitiColorVariation{
+				"shark white":  {ImageUrl: "https://img.example/recoil-white.png", InspectUrl: "steam://inspect/recoil-white"},
+				"tiger orange": {ImageUrl: "https://img.example/recoil-orange.png"},
+			},
+		},
+	}}
+	sameJSON(t, got, want)
+	if warnings := page.Warnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "Tiger Orange") {
+		t.Errorf("warnings = %v, want one for the missing inspect url of Tiger Orange", warnings)
+	}
+}
+
+func TestScrapePatchPack(t *testing.T) {
+	// The listing only queues the packs on it
+	listing := parsePage(t, "https://csgostash.example/patches/packs", `<div class="well result-box nomargin"><a href="/patches/pack/1/metal-skill-group"><h4>Metal Skill Group Patch Collection</h4></a></div>`)
+	if got, errs := ScrapePatchPack(listing); len(got) != 0 || len(errs) != 0 {
+		t.Errorf("listing gave %v, %v", got, errs)
+	}
+	if want := "https://csgostash.example/patches/pack/1/metal-skill-group"; strings.Join(listing.Links(), " ") != want {
+		t.Errorf("queued %v, want %s", listing.Links(), want)
+	}
+
+	page := parsePage(t, "https://csgostash.example/patches/pack/1/metal-skill-group", `<div class="collapsed-top-margin"><h1>Metal Skill Group Patch Collection</h1></div>
+<img class="content-header-img-margin" src="https://img.example/metal-skill-group.png">
+<div class="well result-box nomargin"><h3>Patch | Silver</h3><div class="quality">High Grade Patch</div></div>
+<div class="well result-box nomargin"><h3>Patch | Global Elite</h3><div class="quality">Exotic Patch</div></div>`)
+	got, errs := ScrapePatchPack(page)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	want := []multiscraper.Keyed[PatchPack]{{
+		Key:  "metal skill group patch collection",
+		Name: "Metal Skill Group Patch Collection",
+		Item: PatchPack{
+			FormattedName: "Metal Skill Group Patch Collection",
+			ImageURL:      "https://img.example/metal-skill-group.png",
+			Items: itemsByQuality(
+				"high grade", []string{"patch silver"},
+				"exotic", []string{"patch global elite"},
+			),
+		},
+	}}
+	sameJSON(t, got, want)
+}
+
+func TestScrapePin(t *testing.T) {
+	page := parsePage(t, "https://csgostash.example/pin/3/guardian", `<div class="well result-box nomargin">
+	<h2>Pin | Guardian</h2>
+	<div class="quality">Remarkable Collectible</div>
+	<img class="main-skin-img" src="https://img.example/guardian.png">
+	<a href="steam://inspect/guardian">Inspect</a>
+</div>
+<div class="skin-misc-details">
+	<p><strong>Description: </strong>A pin for the guardians.</p>
+</div>
+<div><div class="skin-details-collection-container-wrapper">Series 1 Collectible Pins Capsule</div></div>`)
+	got, errs := ScrapePin(page)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	want := []multiscraper.Keyed[Pin]{{
+		Key:  "guardian",
+		Name: "Guardian",
+		Item: Pin{
+			FormattedName:     "Guardian",
+			Description:       "A pin for the guardians.",
+			Quality:           "remarkable",
+			InspectURLs:       []string{"steam://inspect/guardian"},
+			ImageURLs:         []string{"https://img.example/guardian.png"},
+			ContainersFoundIn: []string{"series 1 collectible pins capsule"},
+		},
+	}}
+	sameJSON(t, got, want)
+}
+
+func TestScrapePinCapsule(t *testing.T) {
+	page := parsePage(t, "https://csgostash.example/pins/capsule/1/series-1", `<div class="collapsed-top-margin"><h1>Series 1 Collectible Pins Capsule</h1></div>
+<img class="content-header-img-margin" src="https://img.example/pins-series-1.png">
+<div class="well result-box nomargin"><h3>Pin | Guardian</h3><div class="quality">Remarkable Collectible</div></div>
+<div class="well result-box nomargin"><h3>Pin | Howl</h3><div class="quality">Extraordinary Collectible</div></div>`)
+	got, errs := ScrapePinCapsule(page)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	want := []multiscraper.Keyed[PinCapsule]{{
+		Key:  "series 1 collectible pins capsule",
+		Name: "Series 1 Collectible Pins Capsule",
+		Item: PinCapsule{
+			FormattedName: "Series 1 Collectible Pins Capsule",
+			ImageURL:      "https://img.example/pins-series-1.png",
+			Items: itemsByQuality(
+				"remarkable", []string{"pin guardian"},
+				"extraordinary", []string{"pin howl"},
+			),
+		},
+	}}
+	sameJSON(t, got, want)
+}
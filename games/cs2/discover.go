@@ -0,0 +1,95 @@
+package cs2
+
+import (
+	"gocasesapi/multiscraper"
+	"net/url"
+	"regexp"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Which links file a discovered link belongs in
+type LinkKind string
+
+const (
+	LinkCase           LinkKind = "cases"
+	LinkCollection     LinkKind = "collections"
+	LinkStickerCapsule LinkKind = "sticker_capsules"
+	LinkSkin           LinkKind = "skins"
+)
+
+// A page found by DiscoverLinks
+type DiscoveredLink struct {
+	URL  string
+	Kind LinkKind
+}
+
+var (
+	casePath           = regexp.MustCompile(`^/case/\d+/[^/]+$`)
+	collectionPath     = regexp.MustCompile(`^/collection/[^/]+$`)
+	stickerCapsulePath = regexp.MustCompile(`^/stickers/capsule/\d+/[^/]+$`)
+	skinPath           = regexp.MustCompile(`^/(skin|glove)/\d+/[^/]+$`)
+	agentPath          = regexp.MustCompile(`^/agent/\d+/[^/]+$`)
+	musicKitPath       = regexp.MustCompile(`^/music/\d+/[^/]+$`)
+	graffitiPath       = regexp.MustCompile(`^/graffiti/\d+/[^/]+$`)
+	patchPackPath      = regexp.MustCompile(`^/patches/pack/\d+/[^/]+$`)
+	pinPath            = regexp.MustCompile(`^/pin/\d+/[^/]+$`)
+	pinCapsulePath     = regexp.MustCompile(`^/pins/capsule/\d+/[^/]+$`)
+)
+
+// Crawl csgostash from its index pages and collect links to every case, collection, sticker
+// capsule and skin, keyed by url. Cases and collections linked from any page are queued so their
+// skins are found too, along with the rare special items listing of every case and the
+// following pages of paginated indexes. Patch packs and pin capsules are not collected, their
+// links files hold the listing and the containers are found from it on every scrape
+func DiscoverLinks(page *multiscraper.Page) ([]multiscraper.Keyed[DiscoveredLink], []error) {
+	if page.Url == nil {
+		return nil, nil
+	}
+	enqueueFollowingPages(page)
+	onContainer := casePath.MatchString(page.Url.Path) || collectionPath.MatchString(page.Url.Path)
+
+	var queue []string
+	found := make(map[string]LinkKind)
+	page.Find("a[href]").Each(func(i int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		link, err := page.Url.Parse(href)
+		if err != nil || link.Host != page.Url.Host {
+			return
+		}
+		// Rare special items are listed on the case page with a query string
+		if onContainer && link.Path == page.Url.Path && link.RawQuery != "" {
+			queue = append(queue, pageOnly(link))
+			return
+		}
+		link.RawQuery = ""
+		link.Fragment = ""
+		switch {
+		case casePath.MatchString(link.Path):
+			found[link.String()] = LinkCase
+			queue = append(queue, link.String())
+		case collectionPath.MatchString(link.Path):
+			found[link.String()] = LinkCollection
+			queue = append(queue, link.String())
+		case stickerCapsulePath.MatchString(link.Path):
+			found[link.String()] = LinkStickerCapsule
+		case skinPath.MatchString(link.Path) && onContainer:
+			// Skin pages link to other skins, only trust what containers list
+			found[link.String()] = LinkSkin
+		}
+	})
+	page.Enqueue(queue...)
+
+	links := make([]multiscraper.Keyed[DiscoveredLink], 0, len(found))
+	for link, kind := range found {
+		links = append(links, multiscraper.Keyed[DiscoveredLink]{Key: link, Item: DiscoveredLink{URL: link, Kind: kind}})
+	}
+	return links, nil
+}
+
+// Url without its fragment
+func pageOnly(link *url.URL) string {
+	page := *link
+	page.Fragment = ""
+	return page.String()
+}
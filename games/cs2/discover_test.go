@@ -0,0 +1,78 @@
+package cs2
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func discovered(t *testing.T, pageUrl string, html string) (map[string]LinkKind, []string) {
+	t.Helper()
+	page := parsePage(t, pageUrl, html)
+	links, errs := DiscoverLinks(page)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	found := make(map[string]LinkKind)
+	for _, link := range links {
+		if link.Key != link.Item.URL {
+			t.Errorf("%s is keyed as %s", link.Item.URL, link.Key)
+		}
+		found[link.Item.URL] = link.Item.Kind
+	}
+	queued := page.Links()
+	sort.Strings(queued)
+	return found, queued
+}
+
+func TestDiscoverLinksFromIndex(t *testing.T) {
+	found, queued := discovered(t, "https://csgostash.com/containers/skin-cases", `
+<a href="/case/307/Fracture-Case#top">Fracture Case</a>
+<a href="https://csgostash.com/collection/The+Vertigo+Collection">Vertigo</a>
+<a href="/stickers/capsule/400/Copenhagen-2024-Contenders-Sticker-Capsule">Contenders</a>
+<a href="/skin/892/Dual-Berettas-Cobra-Strike">Skins on an index are not trusted</a>
+<a href="https://elsewhere.example/case/1/Other-Case">Other site</a>
+<ul class="pagination"><li><a href="?page=2">2</a></li></ul>`)
+
+	want := map[string]LinkKind{
+		"https://csgostash.com/case/307/Fracture-Case":                                          LinkCase,
+		"https://csgostash.com/collection/The+Vertigo+Collection":                               LinkCollection,
+		"https://csgostash.com/stickers/capsule/400/Copenhagen-2024-Contenders-Sticker-Capsule": LinkStickerCapsule,
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("found %v, want %v", found, want)
+	}
+	// Containers are crawled for their skins, as are the following pages of the index
+	wantQueued := []string{
+		"https://csgostash.com/case/307/Fracture-Case",
+		"https://csgostash.com/collection/The+Vertigo+Collection",
+		"https://csgostash.com/containers/skin-cases?page=2",
+	}
+	if !reflect.DeepEqual(queued, wantQueued) {
+		t.Errorf("queued %v, want %v", queued, wantQueued)
+	}
+}
+
+func TestDiscoverLinksFromCase(t *testing.T) {
+	found, queued := discovered(t, "https://csgostash.com/case/307/Fracture-Case", `
+<a href="/skin/892/Dual-Berettas-Cobra-Strike">Cobra Strike</a>
+<a href="/glove/10/Sport-Gloves-Vice">Vice</a>
+<a href="/case/307/Fracture-Case?Knives=1#items">Rare special items</a>
+<a href="/case/339/Dreams-&-Nightmares-Case">Related case</a>`)
+
+	want := map[string]LinkKind{
+		"https://csgostash.com/skin/892/Dual-Berettas-Cobra-Strike": LinkSkin,
+		"https://csgostash.com/glove/10/Sport-Gloves-Vice":          LinkSkin,
+		"https://csgostash.com/case/339/Dreams-&-Nightmares-Case":   LinkCase,
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("found %v, want %v", found, want)
+	}
+	wantQueued := []string{
+		"https://csgostash.com/case/307/Fracture-Case?Knives=1",
+		"https://csgostash.com/case/339/Dreams-&-Nightmares-Case",
+	}
+	if !reflect.DeepEqual(queued, wantQueued) {
+		t.Errorf("queued %v, want %v", queued, wantQueued)
+	}
+}
@@ -1,6 +1,8 @@
 package cs2
 
 import (
+	"gocasesapi/multiscraper"
+
 	orderedmap "github.com/wk8/go-ordered-map/v2"
 )
 
@@ -10,6 +12,7 @@ type Container struct {
 	ImageURL      string                                   `json:"image_url"`
 	Items         *orderedmap.OrderedMap[string, []string] `json:"items"`
 	RequiresKey   bool                                     `json:"requires_key"`
+	Source        *multiscraper.Source                     `json:"source,omitempty"`
 }
 type Case Container
 type StickerCapsule Container
@@ -17,22 +20,24 @@ type PatchPack Container
 type PinCapsule Container
 type Collection Container
 type SouvenirPackage struct {
-	FormattedName string `json:"formatted_name"`
-	ImageURL      string `json:"image_url"`
-	Collection    string `json:"collection"`
+	FormattedName string               `json:"formatted_name"`
+	ImageURL      string               `json:"image_url"`
+	Collection    string               `json:"collection"`
+	Source        *multiscraper.Source `json:"source,omitempty"`
 }
 
 // Items
 type Item struct {
-	FormattedName     string   `json:"formatted_name"`
-	Description       string   `json:"description"`
-	FlavorText        string   `json:"flavor_text"`
-	Quality           string   `json:"quality"`
-	InspectURLs       []string `json:"inspect_urls"`
-	ImageURLs         []string `json:"image_urls"`
-	StattrakAvailable bool     `json:"stattrak_available"`
-	SouvenirAvailable bool     `json:"souvenir_available"`
-	ContainersFoundIn []string `json:"containers_found_in"`
+	FormattedName     string               `json:"formatted_name"`
+	Description       string               `json:"description"`
+	FlavorText        string               `json:"flavor_text"`
+	Quality           string               `json:"quality"`
+	InspectURLs       []string             `json:"inspect_urls"`
+	ImageURLs         []string             `json:"image_urls"`
+	StattrakAvailable bool                 `json:"stattrak_available"`
+	SouvenirAvailable bool                 `json:"souvenir_available"`
+	ContainersFoundIn []string             `json:"containers_found_in"`
+	Source            *multiscraper.Source `json:"source,omitempty"`
 }
 type SkinVariation struct {
 	FormattedName   string   `json:"formatted_name"`
@@ -51,7 +56,11 @@ type Skin struct {
 type Sticker Item
 type Patch Item
 type Pin Item
-type Agent Item
+type Agent struct {
+	Item
+	// "ct" or "t"
+	Faction string `json:"faction"`
+}
 type MusicKit struct {
 	Item
 	Artist    string            `json:"artist"`
@@ -65,3 +74,14 @@ type Graffiti struct {
 	Item
 	ColorVarations map[string]GraffitiColorVariation `json:"color_variations"`
 }
+
+// Provenance, see multiscraper.Sourced. Skin and the other types embedding Item get SetSource
+// through the embedded Item, types declared as Container or Item need their own
+func (c *Container) SetSource(source *multiscraper.Source)       { c.Source = source }
+func (p *PatchPack) SetSource(source *multiscraper.Source)       { p.Source = source }
+func (p *PinCapsule) SetSource(source *multiscraper.Source)      { p.Source = source }
+func (p *SouvenirPackage) SetSource(source *multiscraper.Source) { p.Source = source }
+func (i *Item) SetSource(source *multiscraper.Source)            { i.Source = source }
+func (s *Sticker) SetSource(source *multiscraper.Source)         { s.Source = source }
+func (p *Patch) SetSource(source *multiscraper.Source)           { p.Source = source }
+func (p *Pin) SetSource(source *multiscraper.Source)             { p.Source = source }
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"io"
 	"log"
 	"os"
 )
@@ -11,3 +12,10 @@ var (
 	Error   = log.New(os.Stdout, "\u001b[31mERROR: \u001b[0m", log.LstdFlags|log.Lshortfile)
 	Debug   = log.New(os.Stdout, "\u001b[36mDEBUG: \u001B[0m", log.LstdFlags|log.Lshortfile)
 )
+
+// Send every logger to w instead of stdout
+func SetOutput(w io.Writer) {
+	for _, logger := range []*log.Logger{Info, Warning, Error, Debug} {
+		logger.SetOutput(w)
+	}
+}
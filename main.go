@@ -1,29 +1,207 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"gocasesapi/games/cs2"
 	"gocasesapi/log"
 	"gocasesapi/multiscraper"
 	"gocasesapi/util"
+	"io/fs"
+	"net"
+	"net/http"
 	"os"
-	"sync"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
 	"time"
-
-	"github.com/PuerkitoBio/goquery"
 )
 
-func scrapeData[T any](pathToLinks string, outputPath string, callback func(*sync.Mutex, *goquery.Document, map[string]T)) {
+// Scrape every link in a file and write the results to a json file. Partial results from a
+// cancelled run are not written so the previous output file is left untouched, they are kept
+// in the checkpoint for a later run to resume from instead. Neither are the results of a run
+// failed by a key collision, which are missing the items that were dropped
+func scrapeData[T any](ctx context.Context, opts multiscraper.Options, cache *multiscraper.CachingFetcher, report *scrapeReport, pathToLinks string, outputPath string, scrape func(*multiscraper.Page) ([]multiscraper.Keyed[T], []error)) multiscraper.Status {
 	log.Info.Printf("Scraping %s", pathToLinks)
 	data := make(map[string]T)
 	links, err := util.ReadLines(pathToLinks)
 	if err != nil {
 		log.Error.Println(err)
 	}
-	multiscraper.MultiScrape(links, data, 20, callback)
+	if opts.Checkpoint.Path != "" {
+		// The checkpoint directory is shared, give every output a file of its own
+		opts.Checkpoint.Path = filepath.Join(opts.Checkpoint.Path, filepath.Base(outputPath))
+	}
+	opts.Name = strings.TrimSuffix(filepath.Base(outputPath), filepath.Ext(outputPath))
+	// The cache is shared by every scrape, which run one after the other
+	var cacheBefore multiscraper.CacheStats
+	if cache != nil {
+		cacheBefore = cache.Stats()
+	}
+	run := multiscraper.MultiScrape[T](ctx, links, data, opts, multiscraper.ScraperFunc[T](scrape))
+	report.add(outputPath, run)
+	cacheSummary := ""
+	if cache != nil {
+		stats := cache.Stats()
+		cacheSummary = fmt.Sprintf(", %d cache hits, %d revalidated, %d cache misses", stats.Hits-cacheBefore.Hits, stats.Revalidated-cacheBefore.Revalidated, stats.Misses-cacheBefore.Misses)
+	}
+	log.Info.Printf("Finished %s: %d scraped, %d failed, %d skipped, %d disallowed by robots.txt%s", pathToLinks, run.Count(multiscraper.URLScraped), run.Count(multiscraper.URLFailed), run.Count(multiscraper.URLSkipped), run.Count(multiscraper.URLDisallowed), cacheSummary)
+	if len(run.Collisions) > 0 {
+		log.Warning.Printf("%d key collisions in %s, see output/cs2/_report.json", len(run.Collisions), pathToLinks)
+	}
+	if run.Status == multiscraper.StatusFailed {
+		log.Error.Printf("Key collisions failed the scrape of %s, not writing %s", pathToLinks, outputPath)
+		return run.Status
+	}
+	if run.Status != multiscraper.StatusComplete {
+		log.Warning.Printf("Scrape of %s was %s, not writing %s", pathToLinks, run.Status, outputPath)
+		return run.Status
+	}
 	util.WriteJsonToFile(outputPath, data)
+	if opts.Checkpoint.Path != "" {
+		// Everything made it into the output, there is nothing left to resume
+		err = os.Remove(opts.Checkpoint.Path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Warning.Println(err)
+		}
+	}
+	return run.Status
+}
+
+// Per url outcome of every scrape in a run of main, written next to the output
+type scrapeReport struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// Share of the urls attempted by this run that failed over every scrape, urls resumed from a
+	// checkpoint were attempted by an earlier run and are left out
+	FailureRate float64 `json:"failure_rate"`
+	// Keyed by output file name
+	Scrapes map[string]multiscraper.Result `json:"scrapes"`
+}
+
+func (r *scrapeReport) add(outputPath string, run multiscraper.Result) {
+	r.Scrapes[filepath.Base(outputPath)] = run
+	attempted, failed := 0, 0
+	for _, run := range r.Scrapes {
+		attempted += len(run.URLs) - run.Count(multiscraper.URLSkipped) - run.Count(multiscraper.URLDisallowed) - run.Resumed()
+		failed += run.Count(multiscraper.URLFailed)
+	}
+	if attempted > 0 {
+		r.FailureRate = float64(failed) / float64(attempted)
+	}
 }
 
 func main() {
+	// go run . discover regenerates the links files instead of scraping
+	args := os.Args[1:]
+	discovering := len(args) > 0 && args[0] == "discover"
+	if discovering {
+		args = args[1:]
+	}
+	c, err := parseConfig(args)
+	if err != nil {
+		log.Error.Fatalln(err)
+	}
+	sources, err := c.openSources()
+	if err != nil {
+		log.Error.Fatalln(err)
+	}
+	defer sources.Close()
+	opts := c.scrape
+	opts.Fetcher = sources.fetcher
+	// One limiter for every scrape so they all draw from the same budget
+	opts.Limiter = multiscraper.NewLimiter(c.limiter)
+	opts.Robots = multiscraper.NewRobots(opts.Fetcher, c.robotsIgnored())
+
+	// Stop scraping cleanly on Ctrl-C or when the scheduler asks us to
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Shown on stderr, logs are kept from drawing over the progress line
+	progress := multiscraper.NewProgress(os.Stderr, c.progress, c.progressEvery)
+	log.SetOutput(progress.Writer(os.Stdout))
+	progressCtx, stopProgress := context.WithCancel(context.Background())
+	progressDone := make(chan struct{})
+	go func() {
+		progress.Run(progressCtx)
+		close(progressDone)
+	}()
+	// Clear the line before the last logs go out
+	endProgress := func() {
+		stopProgress()
+		<-progressDone
+	}
+	defer endProgress()
+	opts.Progress = progress
+
+	if c.metricsAddr != "" {
+		opts.Metrics = multiscraper.NewMetrics()
+		opts.Robots.Metrics = opts.Metrics
+		server, err := serveMetrics(c.metricsAddr, opts.Metrics)
+		if err != nil {
+			log.Error.Fatalln(err)
+		}
+		defer server.Close()
+	}
+
+	if discovering {
+		opts.Name = "discover"
+		complete := discover(ctx, opts)
+		endProgress()
+		sources.logStats()
+		if !complete {
+			sources.Close()
+			stop()
+			os.Exit(1)
+		}
+		return
+	}
+
+	if c.every <= 0 {
+		err = scrapeAll(ctx, opts, sources.cache, c.maxFailureRate)
+		endProgress()
+		sources.logStats()
+		if err != nil {
+			log.Error.Println(err)
+			sources.Close()
+			stop()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Daemon mode, scrape every c.every until told to stop with the metrics served throughout
+	for {
+		startTime := time.Now()
+		err := scrapeAll(ctx, opts, sources.cache, c.maxFailureRate)
+		sources.logStats()
+		if ctx.Err() != nil {
+			log.Info.Println("Stopping")
+			return
+		}
+		opts.Metrics.ObserveRun(err == nil)
+		if err != nil {
+			log.Error.Println(err)
+		}
+		next := startTime.Add(c.every)
+		log.Info.Printf("Next scrape at %s", next.Format(time.RFC3339))
+		select {
+		case <-ctx.Done():
+			log.Info.Println("Stopping")
+			return
+		case <-time.After(time.Until(next)):
+		}
+		// Sites may have changed their robots.txt since the last run
+		opts.Robots = multiscraper.NewRobots(opts.Fetcher, c.robotsIgnored())
+		opts.Robots.Metrics = opts.Metrics
+	}
+}
+
+// Scrape every links file into output/cs2 and write the report, returning an error when the
+// run was interrupted, had an output failed by key collisions or had too many urls fail
+func scrapeAll(ctx context.Context, opts multiscraper.Options, cache *multiscraper.CachingFetcher, maxFailureRate float64) error {
 	err := os.MkdirAll("output", os.ModePerm)
 	if err != nil {
 		log.Error.Fatalln(err)
@@ -34,14 +212,61 @@ func main() {
 		log.Error.Fatalln(err)
 	}
 
+	// Once cancelled every remaining scrapeData call returns straight away with a partial status
 	startTime := time.Now()
-	scrapeData("links/cs2/skins.txt", "output/cs2/skins.json", cs2.ScrapeSkinLink)
-	scrapeData("links/cs2/cases.txt", "output/cs2/cases.json", cs2.ScrapeContainer)
-	scrapeData("links/cs2/stickers.txt", "output/cs2/stickers.json", cs2.ScrapeStickerPage)
-	scrapeData("links/cs2/sticker_capsules.txt", "output/cs2/sticker_capsules.json", cs2.ScrapeContainer)
-	scrapeData("links/cs2/collections.txt", "output/cs2/collections.json", cs2.ScrapeContainer)
-	scrapeData("links/cs2/souvenir_packages.txt", "output/cs2/souvenir_packages.json", cs2.ScrapeSouvenirPackagePage)
+	report := scrapeReport{GeneratedAt: startTime.UTC(), Scrapes: make(map[string]multiscraper.Result)}
+	scrapeData(ctx, opts, cache, &report, "links/cs2/skins.txt", "output/cs2/skins.json", cs2.ScrapeSkinLink)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/cases.txt", "output/cs2/cases.json", cs2.ScrapeContainer)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/stickers.txt", "output/cs2/stickers.json", cs2.ScrapeStickerPage)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/sticker_capsules.txt", "output/cs2/sticker_capsules.json", cs2.ScrapeContainer)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/collections.txt", "output/cs2/collections.json", cs2.ScrapeContainer)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/souvenir_packages.txt", "output/cs2/souvenir_packages.json", cs2.ScrapeSouvenirPackagePage)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/agents.txt", "output/cs2/agents.json", cs2.ScrapeAgent)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/music_kits.txt", "output/cs2/music_kits.json", cs2.ScrapeMusicKit)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/music_kit_boxes.txt", "output/cs2/music_kit_boxes.json", cs2.ScrapeMusicKitBox)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/graffiti.txt", "output/cs2/graffiti.json", cs2.ScrapeGraffiti)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/patches.txt", "output/cs2/patches.json", cs2.ScrapePatchPage)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/patch_packs.txt", "output/cs2/patch_packs.json", cs2.ScrapePatchPack)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/pins.txt", "output/cs2/pins.json", cs2.ScrapePin)
+	scrapeData(ctx, opts, cache, &report, "links/cs2/pin_capsules.txt", "output/cs2/pin_capsules.json", cs2.ScrapePinCapsule)
+	util.WriteJsonToFile("output/cs2/_report.json", report)
 	endTime := time.Now()
 	elapsedTime := endTime.Sub(startTime)
 	log.Info.Printf("Execution time: %s\n", elapsedTime)
+
+	if ctx.Err() != nil {
+		return errors.New("scrape was interrupted, output is incomplete")
+	}
+	var collided []string
+	for outputName, run := range report.Scrapes {
+		if run.Status == multiscraper.StatusFailed {
+			collided = append(collided, outputName)
+		}
+	}
+	if len(collided) > 0 {
+		sort.Strings(collided)
+		return fmt.Errorf("not written because of key collisions: %s, see output/cs2/_report.json", strings.Join(collided, ", "))
+	}
+	if report.FailureRate > maxFailureRate {
+		return fmt.Errorf("%.1f%% of urls failed, more than the allowed %.1f%%, see output/cs2/_report.json", report.FailureRate*100, maxFailureRate*100)
+	}
+	return nil
+}
+
+// Serve metrics at /metrics on addr until the returned server is closed
+func serveMetrics(addr string, metrics *multiscraper.Metrics) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error.Println(err)
+		}
+	}()
+	log.Info.Printf("Serving metrics on http://%s/metrics", listener.Addr())
+	return server, nil
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"gocasesapi/multiscraper"
+)
+
+func TestFailureRateLeavesOutResumedUrls(t *testing.T) {
+	report := scrapeReport{Scrapes: make(map[string]multiscraper.Result)}
+	report.add("output/cs2/skins.json", multiscraper.Result{URLs: []multiscraper.URLResult{
+		{State: multiscraper.URLScraped, Resumed: true},
+		{State: multiscraper.URLScraped, Resumed: true},
+		{State: multiscraper.URLScraped, Resumed: true},
+		{State: multiscraper.URLScraped},
+		{State: multiscraper.URLFailed},
+	}})
+	report.add("output/cs2/cases.json", multiscraper.Result{URLs: []multiscraper.URLResult{
+		{State: multiscraper.URLScraped},
+		{State: multiscraper.URLSkipped},
+		{State: multiscraper.URLDisallowed},
+	}})
+	// One failure out of the three urls this run attempted
+	if want := 1.0 / 3; report.FailureRate != want {
+		t.Errorf("failure rate = %v, want %v", report.FailureRate, want)
+	}
+}
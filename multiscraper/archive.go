@@ -0,0 +1,176 @@
+package multiscraper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gocasesapi/util"
+)
+
+// Name of the file in an archive directory listing every recorded page, one json object per line
+const ArchiveManifest = "manifest.jsonl"
+
+// A single recorded page in the manifest of an archive
+type archiveEntry struct {
+	URL        string      `json:"url"`
+	RecordedAt time.Time   `json:"recorded_at"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	// Path of the body relative to the archive directory, laid out like a DirFetcher
+	File string `json:"file"`
+}
+
+// Wraps a fetcher and saves every response it gives into an archive directory, so a run can
+// be replayed later with a ReplayFetcher. Bodies are laid out like a DirFetcher so the pages
+// can be opened and checked by hand
+type RecordingFetcher struct {
+	Dir   string
+	Inner Fetcher
+
+	mtx      sync.Mutex
+	manifest *os.File
+}
+
+// Start recording into dir, adding to what is already recorded there
+func NewRecordingFetcher(dir string, inner Fetcher) (*RecordingFetcher, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := os.OpenFile(filepath.Join(dir, ArchiveManifest), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingFetcher{Dir: dir, Inner: inner, manifest: manifest}, nil
+}
+
+func (f *RecordingFetcher) IsLocal(webUrl string) bool {
+	local, ok := f.Inner.(LocalFetcher)
+	return ok && local.IsLocal(webUrl)
+}
+
+func (f *RecordingFetcher) Fetch(ctx context.Context, webUrl string) (*Response, error) {
+	res, err := f.Inner.Fetch(ctx, webUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.record(res); err != nil {
+		return nil, fmt.Errorf("recording %s: %w", webUrl, err)
+	}
+	return res, nil
+}
+
+func (f *RecordingFetcher) Close() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.manifest.Close()
+}
+
+func (f *RecordingFetcher) record(res *Response) error {
+	entry := archiveEntry{
+		URL:        res.URL,
+		RecordedAt: time.Now().UTC(),
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+	}
+	if len(res.Body) > 0 {
+		path, err := DirFetcher{Root: f.Dir}.Path(res.URL)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		err = util.WriteFileAtomic(path, res.Body)
+		if err != nil {
+			return err
+		}
+		entry.File, err = filepath.Rel(f.Dir, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	_, err = f.manifest.Write(append(line, '\n'))
+	return err
+}
+
+// Serves the pages recorded into an archive directory by a RecordingFetcher with the status
+// and headers they were recorded with. Urls that were never recorded get a 404
+type ReplayFetcher struct {
+	Dir     string
+	entries map[string]archiveEntry
+}
+
+// Load the manifest of an archive, when a url was recorded more than once the latest wins
+func NewReplayFetcher(dir string) (*ReplayFetcher, error) {
+	file, err := os.Open(filepath.Join(dir, ArchiveManifest))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make(map[string]archiveEntry)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry archiveEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", ArchiveManifest, line, err)
+		}
+		if previous, ok := entries[entry.URL]; !ok || !entry.RecordedAt.Before(previous.RecordedAt) {
+			entries[entry.URL] = entry
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &ReplayFetcher{Dir: dir, entries: entries}, nil
+}
+
+// When a url was recorded, false if it is not in the archive
+func (f *ReplayFetcher) RecordedAt(webUrl string) (time.Time, bool) {
+	entry, ok := f.entries[webUrl]
+	return entry.RecordedAt, ok
+}
+
+func (f *ReplayFetcher) IsLocal(webUrl string) bool {
+	return true
+}
+
+func (f *ReplayFetcher) Fetch(ctx context.Context, webUrl string) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entry, ok := f.entries[webUrl]
+	if !ok {
+		return notFound(webUrl), nil
+	}
+	res := &Response{
+		URL:        webUrl,
+		StatusCode: entry.StatusCode,
+		Header:     entry.Header,
+	}
+	if entry.File != "" {
+		body, err := os.ReadFile(filepath.Join(f.Dir, entry.File))
+		if err != nil {
+			return nil, err
+		}
+		res.Body = body
+	}
+	return res, nil
+}
@@ -0,0 +1,77 @@
+package multiscraper
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	pages := NewMapFetcher(map[string]string{
+		"http://site.example/1":             "first",
+		"http://site.example/list?page=2":   "second",
+		"http://site.example/dir/":          "index",
+		"http://site.example/changes-later": "old",
+	})
+	pages["http://site.example/busy"] = &Response{
+		URL:        "http://site.example/busy",
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Retry-After": {"30"}},
+	}
+	recorder, err := NewRecordingFetcher(dir, pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for webUrl := range pages {
+		if _, err := recorder.Fetch(ctx, webUrl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Recorded again, the replay serves the latest recording
+	pages["http://site.example/changes-later"].Body = []byte("new")
+	if _, err := recorder.Fetch(ctx, "http://site.example/changes-later"); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := NewReplayFetcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for webUrl, want := range pages {
+		got, err := replay.Fetch(ctx, webUrl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.StatusCode != want.StatusCode || string(got.Body) != string(want.Body) || got.Header.Get("Retry-After") != want.Header.Get("Retry-After") {
+			t.Errorf("replayed %s = %d %q %v, want %d %q %v", webUrl, got.StatusCode, got.Body, got.Header, want.StatusCode, want.Body, want.Header)
+		}
+		if _, ok := replay.RecordedAt(webUrl); !ok {
+			t.Errorf("%s has no recording time", webUrl)
+		}
+	}
+	if got, err := replay.Fetch(ctx, "http://site.example/never"); err != nil || got.StatusCode != http.StatusNotFound {
+		t.Errorf("unrecorded url = %v, %v, want a 404", got, err)
+	}
+
+	// A run over the replay scrapes what the recorded run did
+	urls := []string{"http://site.example/1", "http://site.example/list?page=2", "http://site.example/changes-later"}
+	opts := DefaultOptions
+	opts.Fetcher = replay
+	result := make(map[string]string)
+	run := MultiScrape[string](ctx, urls, result, opts, ScraperFunc[string](func(page *Page) ([]Keyed[string], []error) {
+		return []Keyed[string]{{Key: page.Url.String(), Item: page.Text()}}, nil
+	}))
+	if run.Status != StatusComplete || run.Count(URLScraped) != len(urls) {
+		t.Fatalf("replayed run = %s with %d scraped", run.Status, run.Count(URLScraped))
+	}
+	for _, webUrl := range urls {
+		if result[webUrl] != string(pages[webUrl].Body) {
+			t.Errorf("result[%q] = %q, want %q", webUrl, result[webUrl], pages[webUrl].Body)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package multiscraper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"gocasesapi/log"
+	"gocasesapi/util"
+)
+
+// Fetchers that can send extra request headers, used by CachingFetcher for conditional requests
+type HeaderFetcher interface {
+	FetchWithHeader(ctx context.Context, url string, header http.Header) (*Response, error)
+}
+
+// Fetchers that can answer some urls without going over the network. MultiScrape does not
+// wait on the rate limiter for those urls
+type LocalFetcher interface {
+	IsLocal(url string) bool
+}
+
+// Persistent cache in front of another fetcher. Entries older than TTL are revalidated with
+// If-None-Match/If-Modified-Since and a 304 is served from the cache
+type CachingFetcher struct {
+	Dir   string
+	Inner Fetcher
+	// How long an entry is served without asking the server, 0 revalidates every time
+	TTL time.Duration
+	// Ignore what is cached and fetch every page again, the fresh pages are still stored
+	ForceRefresh bool
+
+	// Updated atomically
+	hits        int64
+	revalidated int64
+	misses      int64
+}
+
+// Totals over every request a CachingFetcher has served
+type CacheStats struct {
+	// Served from the cache without a request
+	Hits int64
+	// Served from the cache after the server answered 304
+	Revalidated int64
+	// Downloaded in full
+	Misses int64
+}
+
+// A cached page as stored on disk
+type cacheEntry struct {
+	URL          string      `json:"url"`
+	StoredAt     time.Time   `json:"stored_at"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	// WARC record of the download the entry came from, if it was archived
+	Source *Source `json:"source,omitempty"`
+}
+
+func NewCachingFetcher(dir string, inner Fetcher, ttl time.Duration) *CachingFetcher {
+	return &CachingFetcher{Dir: dir, Inner: inner, TTL: ttl}
+}
+
+func (f *CachingFetcher) Stats() CacheStats {
+	return CacheStats{
+		Hits:        atomic.LoadInt64(&f.hits),
+		Revalidated: atomic.LoadInt64(&f.revalidated),
+		Misses:      atomic.LoadInt64(&f.misses),
+	}
+}
+
+func (f *CachingFetcher) IsLocal(webUrl string) bool {
+	if f.ForceRefresh || f.TTL <= 0 {
+		return false
+	}
+	// Entries are rewritten whenever they are stored or revalidated, so the modification time
+	// saves us decoding the whole entry
+	info, err := os.Stat(f.path(webUrl))
+	return err == nil && time.Since(info.ModTime()) < f.TTL
+}
+
+func (f *CachingFetcher) Fetch(ctx context.Context, webUrl string) (*Response, error) {
+	var entry *cacheEntry
+	if !f.ForceRefresh {
+		entry = f.load(webUrl)
+	}
+	if entry != nil && f.fresh(entry) {
+		atomic.AddInt64(&f.hits, 1)
+		return entry.response(), nil
+	}
+
+	header := http.Header{}
+	if entry != nil {
+		if entry.ETag != "" {
+			header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	var res *Response
+	var err error
+	if headerFetcher, ok := f.Inner.(HeaderFetcher); ok {
+		res, err = headerFetcher.FetchWithHeader(ctx, webUrl, header)
+	} else {
+		res, err = f.Inner.Fetch(ctx, webUrl)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && entry != nil {
+		atomic.AddInt64(&f.revalidated, 1)
+		entry.StoredAt = time.Now()
+		f.store(entry)
+		revalidated := entry.response()
+		revalidated.Timing = res.Timing
+		revalidated.Proxy = res.Proxy
+		return revalidated, nil
+	}
+
+	atomic.AddInt64(&f.misses, 1)
+	if res.StatusCode == http.StatusOK {
+		f.store(&cacheEntry{
+			URL:          webUrl,
+			StoredAt:     time.Now(),
+			ETag:         res.Header.Get("ETag"),
+			LastModified: res.Header.Get("Last-Modified"),
+			Header:       res.Header,
+			Body:         res.Body,
+			Source:       res.Source,
+		})
+	}
+	return res, nil
+}
+
+func (f *CachingFetcher) fresh(entry *cacheEntry) bool {
+	return f.TTL > 0 && time.Since(entry.StoredAt) < f.TTL
+}
+
+func (f *CachingFetcher) path(webUrl string) string {
+	sum := sha256.Sum256([]byte(webUrl))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(f.Dir, key[:2], key+".json")
+}
+
+// Cached entry for a url, nil if there is none
+func (f *CachingFetcher) load(webUrl string) *cacheEntry {
+	data, err := os.ReadFile(f.path(webUrl))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warning.Printf("Could not read cache entry for %s: %s", webUrl, err)
+		}
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != webUrl {
+		log.Warning.Printf("Ignoring corrupt cache entry for %s", webUrl)
+		return nil
+	}
+	return &entry
+}
+
+// A failure to write to the cache only costs us a download next time, so it is not fatal
+func (f *CachingFetcher) store(entry *cacheEntry) {
+	path := f.path(entry.URL)
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	}
+	if err == nil {
+		err = util.WriteFileAtomic(path, data)
+	}
+	if err != nil {
+		log.Warning.Printf("Could not cache %s: %s", entry.URL, err)
+	}
+}
+
+func (e *cacheEntry) response() *Response {
+	res := &Response{
+		URL:        e.URL,
+		StatusCode: http.StatusOK,
+		Header:     e.Header,
+		Body:       e.Body,
+		FromCache:  true,
+	}
+	if e.Source != nil {
+		source := *e.Source
+		source.FromCache = true
+		res.Source = &source
+	}
+	return res
+}
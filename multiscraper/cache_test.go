@@ -0,0 +1,195 @@
+package multiscraper
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Origin for cache tests, answers conditional requests the way a server would and keeps the
+// headers of every request it gets
+type conditionalFetcher struct {
+	body         string
+	etag         string
+	lastModified string
+	requests     []http.Header
+}
+
+func (f *conditionalFetcher) Fetch(ctx context.Context, webUrl string) (*Response, error) {
+	return f.FetchWithHeader(ctx, webUrl, http.Header{})
+}
+
+func (f *conditionalFetcher) FetchWithHeader(ctx context.Context, webUrl string, header http.Header) (*Response, error) {
+	f.requests = append(f.requests, header.Clone())
+	if (f.etag != "" && header.Get("If-None-Match") == f.etag) ||
+		(f.lastModified != "" && header.Get("If-Modified-Since") == f.lastModified) {
+		return &Response{URL: webUrl, StatusCode: http.StatusNotModified, Header: http.Header{}}, nil
+	}
+	res := &Response{URL: webUrl, StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(f.body)}
+	if f.etag != "" {
+		res.Header.Set("ETag", f.etag)
+	}
+	if f.lastModified != "" {
+		res.Header.Set("Last-Modified", f.lastModified)
+	}
+	return res, nil
+}
+
+const cachedUrl = "http://site.example/page"
+
+func TestCacheServesFreshEntries(t *testing.T) {
+	pages := NewMapFetcher(map[string]string{cachedUrl: "page"})
+	requests := 0
+	inner := fetcherFunc(func(ctx context.Context, webUrl string) (*Response, error) {
+		requests++
+		return pages.Fetch(ctx, webUrl)
+	})
+	cache := NewCachingFetcher(t.TempDir(), inner, time.Hour)
+	ctx := context.Background()
+
+	if cache.IsLocal(cachedUrl) {
+		t.Error("url is local before it was ever fetched")
+	}
+	first, err := cache.Fetch(ctx, cachedUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.FromCache {
+		t.Error("first fetch came from the cache")
+	}
+	if !cache.IsLocal(cachedUrl) {
+		t.Error("fresh entry is not local")
+	}
+	second, err := cache.Fetch(ctx, cachedUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(second.Body) != "page" || !second.FromCache || requests != 1 {
+		t.Errorf("second fetch = %q, from cache %t, after %d requests", second.Body, second.FromCache, requests)
+	}
+	if stats := cache.Stats(); stats != (CacheStats{Hits: 1, Misses: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// Pages that are not 200 are not stored
+	if _, err := cache.Fetch(ctx, "http://site.example/missing"); err != nil {
+		t.Fatal(err)
+	}
+	if cache.IsLocal("http://site.example/missing") {
+		t.Error("404 was cached")
+	}
+
+	// Stale entries and forced refreshes go back to the server
+	cache.TTL = 0
+	if cache.IsLocal(cachedUrl) {
+		t.Error("url is local without a TTL")
+	}
+	cache.TTL = time.Hour
+	cache.ForceRefresh = true
+	if cache.IsLocal(cachedUrl) {
+		t.Error("url is local while refreshing")
+	}
+}
+
+func TestCacheRevalidates(t *testing.T) {
+	tests := []struct {
+		name         string
+		etag         string
+		lastModified string
+		header       string
+	}{
+		{"etag", `"v1"`, "", "If-None-Match"},
+		{"last modified", "", "Mon, 02 Jan 2006 15:04:05 GMT", "If-Modified-Since"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			origin := &conditionalFetcher{body: "page", etag: test.etag, lastModified: test.lastModified}
+			cache := NewCachingFetcher(t.TempDir(), origin, 0)
+			ctx := context.Background()
+			if _, err := cache.Fetch(ctx, cachedUrl); err != nil {
+				t.Fatal(err)
+			}
+			res, err := cache.Fetch(ctx, cachedUrl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(origin.requests) != 2 || origin.requests[1].Get(test.header) == "" {
+				t.Fatalf("requests = %v, want the second with %s", origin.requests, test.header)
+			}
+			if string(res.Body) != "page" || !res.FromCache || res.StatusCode != http.StatusOK {
+				t.Errorf("revalidated page = %d %q, from cache %t", res.StatusCode, res.Body, res.FromCache)
+			}
+			if stats := cache.Stats(); stats != (CacheStats{Revalidated: 1, Misses: 1}) {
+				t.Errorf("stats = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestCacheForceRefresh(t *testing.T) {
+	origin := &conditionalFetcher{body: "old", etag: `"v1"`}
+	cache := NewCachingFetcher(t.TempDir(), origin, time.Hour)
+	ctx := context.Background()
+	if _, err := cache.Fetch(ctx, cachedUrl); err != nil {
+		t.Fatal(err)
+	}
+
+	origin.body = "new"
+	cache.ForceRefresh = true
+	res, err := cache.Fetch(ctx, cachedUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Body) != "new" || res.FromCache {
+		t.Errorf("refreshed page = %q, from cache %t", res.Body, res.FromCache)
+	}
+	if header := origin.requests[1]; header.Get("If-None-Match") != "" {
+		t.Errorf("refresh sent conditional headers %v", header)
+	}
+
+	// The fresh page replaced the old one
+	cache.ForceRefresh = false
+	res, err = cache.Fetch(ctx, cachedUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Body) != "new" || !res.FromCache || len(origin.requests) != 2 {
+		t.Errorf("page after refresh = %q, from cache %t", res.Body, res.FromCache)
+	}
+}
+
+func TestCacheIgnoresCorruptEntries(t *testing.T) {
+	for name, data := range map[string]string{
+		"not json":  "{truncated",
+		"other url": `{"url":"http://site.example/other","body":"b3RoZXI="}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			origin := &conditionalFetcher{body: "page", etag: `"v1"`}
+			cache := NewCachingFetcher(t.TempDir(), origin, time.Hour)
+			path := cache.path(cachedUrl)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := cache.Fetch(context.Background(), cachedUrl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(res.Body) != "page" || res.FromCache {
+				t.Errorf("page = %q, from cache %t, want a download", res.Body, res.FromCache)
+			}
+			if header := origin.requests[0]; header.Get("If-None-Match") != "" {
+				t.Errorf("revalidated a corrupt entry with %v", header)
+			}
+			if entry := cache.load(cachedUrl); entry == nil || string(entry.Body) != "page" {
+				t.Errorf("corrupt entry was not replaced, got %+v", entry)
+			}
+		})
+	}
+}
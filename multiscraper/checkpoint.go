@@ -0,0 +1,103 @@
+package multiscraper
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gocasesapi/log"
+	"gocasesapi/util"
+)
+
+// Settings for saving the progress of a run so it can be picked up again after a crash
+type CheckpointOptions struct {
+	// File progress is saved to, checkpointing is off when empty
+	Path string
+	// How often progress is saved while the run is going, it is always saved when the run ends
+	Interval time.Duration
+	// Load the checkpoint at Path before starting, skipping the urls it has already scraped
+	// and merging its items into the result
+	Resume bool
+}
+
+// What is saved to a checkpoint file
+type checkpointFile[T any] struct {
+	SavedAt time.Time `json:"saved_at"`
+	// Urls that were scraped successfully
+	Done []string `json:"done"`
+	// Every url the run knew about, including those queued by scrapers
+	URLs   []string     `json:"urls"`
+	Result map[string]T `json:"result"`
+	// Where the item under every key of Result came from, so collisions with items scraped
+	// after resuming are still caught
+	Owners map[string]KeyOwner `json:"owners"`
+}
+
+// Checkpoint at path, nil if there is none
+func loadCheckpoint[T any](path string) (*checkpointFile[T], error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint checkpointFile[T]
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// Save the urls of run along with the items in result and who owns their keys. Urls in
+// collided lost an item to CollisionFail and are not counted as done. Must be called with the
+// mutex guarding run held
+func saveCheckpoint[T any](path string, run *Result, result map[string]T, owners map[string]KeyOwner, collided map[int]bool) error {
+	checkpoint := checkpointFile[T]{
+		SavedAt: time.Now().UTC(),
+		Done:    []string{},
+		URLs:    make([]string, 0, len(run.URLs)),
+		Result:  result,
+		Owners:  owners,
+	}
+	for i, urlResult := range run.URLs {
+		checkpoint.URLs = append(checkpoint.URLs, urlResult.URL)
+		if urlResult.State == URLScraped && !collided[i] {
+			checkpoint.Done = append(checkpoint.Done, urlResult.URL)
+		}
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, data)
+}
+
+// Call save with mtx held every interval until stop is closed
+func checkpointPeriodically(path string, interval time.Duration, mtx *sync.Mutex, save func() error, stop <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			mtx.Lock()
+			err := save()
+			mtx.Unlock()
+			if err != nil {
+				log.Warning.Printf("Could not save checkpoint %s: %s", path, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package multiscraper
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "skins.json")
+	if checkpoint, err := loadCheckpoint[string](path); checkpoint != nil || err != nil {
+		t.Fatalf("missing checkpoint = %v, %v, want nothing", checkpoint, err)
+	}
+
+	run := &Result{URLs: []URLResult{
+		{URL: "http://a/1", State: URLScraped},
+		{URL: "http://a/2", State: URLFailed},
+		{URL: "http://a/3", State: URLSkipped},
+		{URL: "http://a/4", State: URLScraped},
+	}}
+	result := map[string]string{"one": "item 1"}
+	owners := map[string]KeyOwner{"one": {URL: "http://a/1", Name: "One"}}
+	// The last url lost its item to a collision, it has to be scraped again
+	if err := saveCheckpoint(path, run, result, owners, map[int]bool{3: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err := loadCheckpoint[string](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"http://a/1"}; !reflect.DeepEqual(checkpoint.Done, want) {
+		t.Errorf("done = %v, want %v", checkpoint.Done, want)
+	}
+	if want := []string{"http://a/1", "http://a/2", "http://a/3", "http://a/4"}; !reflect.DeepEqual(checkpoint.URLs, want) {
+		t.Errorf("urls = %v, want %v", checkpoint.URLs, want)
+	}
+	if !reflect.DeepEqual(checkpoint.Result, result) || !reflect.DeepEqual(checkpoint.Owners, owners) {
+		t.Errorf("result = %v and owners = %v, want %v and %v", checkpoint.Result, checkpoint.Owners, result, owners)
+	}
+}
+
+// Scrapes the path of a page as its item, the first page queues the third
+func scrapePath(page *Page) ([]Keyed[string], []error) {
+	if page.Url.Path == "/1" {
+		page.Enqueue("/3")
+	}
+	return []Keyed[string]{{Key: page.Url.Path, Item: strings.TrimSpace(page.Text())}}, nil
+}
+
+func TestResumeSkipsDoneUrls(t *testing.T) {
+	opts := DefaultOptions
+	opts.Retry.MaxAttempts = 1
+	opts.Checkpoint = CheckpointOptions{Path: filepath.Join(t.TempDir(), "checkpoint.json"), Resume: true}
+	urls := []string{"http://site.example/1", "http://site.example/2"}
+
+	// The second page is missing the first time around
+	opts.Fetcher = NewMapFetcher(map[string]string{
+		"http://site.example/1": "first",
+		"http://site.example/3": "queued",
+	})
+	run := MultiScrape[string](context.Background(), urls, make(map[string]string), opts, ScraperFunc[string](scrapePath))
+	if run.Count(URLScraped) != 2 || run.Count(URLFailed) != 1 {
+		t.Fatalf("first run scraped %d and failed %d, want 2 and 1", run.Count(URLScraped), run.Count(URLFailed))
+	}
+
+	pages := NewMapFetcher(map[string]string{
+		"http://site.example/1": "first again",
+		"http://site.example/2": "second",
+		"http://site.example/3": "queued again",
+	})
+	var mtx sync.Mutex
+	var fetched []string
+	opts.Fetcher = fetcherFunc(func(ctx context.Context, webUrl string) (*Response, error) {
+		mtx.Lock()
+		fetched = append(fetched, webUrl)
+		mtx.Unlock()
+		return pages.Fetch(ctx, webUrl)
+	})
+	result := make(map[string]string)
+	run = MultiScrape[string](context.Background(), urls, result, opts, ScraperFunc[string](scrapePath))
+
+	if want := []string{"http://site.example/2"}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched %v, want only %v", fetched, want)
+	}
+	var resumed []string
+	for _, urlResult := range run.URLs {
+		if urlResult.Resumed {
+			resumed = append(resumed, urlResult.URL)
+		}
+	}
+	sort.Strings(resumed)
+	if want := []string{"http://site.example/1", "http://site.example/3"}; !reflect.DeepEqual(resumed, want) {
+		t.Errorf("resumed %v, want %v", resumed, want)
+	}
+	// Items of the first run are kept as they were scraped
+	want := map[string]string{"/1": "first", "/2": "second", "/3": "queued"}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %v, want %v", result, want)
+	}
+}
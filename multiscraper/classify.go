@@ -0,0 +1,181 @@
+package multiscraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// What a 200 response turned out to be
+type PageKind int
+
+const (
+	// The page we asked for
+	PageContent PageKind = iota
+	// An anti-bot interstitial such as Cloudflare's "Just a moment..."
+	PageChallenge
+	// The site telling us it is down for maintenance
+	PageMaintenance
+	// A not found page served with a 200
+	PageNotFound
+)
+
+func (k PageKind) String() string {
+	switch k {
+	case PageContent:
+		return "content"
+	case PageChallenge:
+		return "challenge"
+	case PageMaintenance:
+		return "maintenance"
+	case PageNotFound:
+		return "soft-404"
+	default:
+		return "unknown"
+	}
+}
+
+func (k PageKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Something that gives a page away as not being content
+type Marker struct {
+	// Response header to look in, the body is searched when empty
+	Header string `json:"header,omitempty"`
+	// Text that has to appear, matched case insensitively
+	Contains string `json:"contains"`
+}
+
+func (m Marker) String() string {
+	if m.Header != "" {
+		return fmt.Sprintf("%s header containing %q", m.Header, m.Contains)
+	}
+	return fmt.Sprintf("body containing %q", m.Contains)
+}
+
+// Markers for each kind of page that is not content, checked in the order of the fields
+type Classifier struct {
+	Challenge   []Marker `json:"challenge"`
+	Maintenance []Marker `json:"maintenance"`
+	NotFound    []Marker `json:"soft_404"`
+}
+
+var DefaultClassifier = Classifier{
+	Challenge: []Marker{
+		{Header: "Cf-Mitigated", Contains: "challenge"},
+		{Contains: "<title>Just a moment...</title>"},
+		{Contains: "<title>Attention Required! | Cloudflare</title>"},
+		{Contains: "/cdn-cgi/challenge-platform/"},
+		{Contains: "cf-browser-verification"},
+	},
+	Maintenance: []Marker{
+		{Contains: "down for maintenance"},
+		{Contains: "<title>Maintenance"},
+	},
+	NotFound: []Marker{
+		{Contains: "<title>404"},
+		{Contains: "<title>Page Not Found"},
+	},
+}
+
+// Read a classifier from a json file shaped like DefaultClassifier, kinds left out of the
+// file keep their default markers
+func LoadClassifier(path string) (Classifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Classifier{}, err
+	}
+	classifier := DefaultClassifier
+	if err := json.Unmarshal(data, &classifier); err != nil {
+		return Classifier{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return classifier, nil
+}
+
+// Work out what a response is, along with the marker that gave it away. Only 200s are looked
+// at, anything else is left for its status code to speak for
+func (c Classifier) Classify(res *Response) (PageKind, Marker) {
+	if res.StatusCode != http.StatusOK {
+		return PageContent, Marker{}
+	}
+	body := bytes.ToLower(res.Body)
+	kinds := []struct {
+		kind    PageKind
+		markers []Marker
+	}{
+		{PageChallenge, c.Challenge},
+		{PageMaintenance, c.Maintenance},
+		{PageNotFound, c.NotFound},
+	}
+	for _, kind := range kinds {
+		for _, marker := range kind.markers {
+			if marker.matches(res, body) {
+				return kind.kind, marker
+			}
+		}
+	}
+	return PageContent, Marker{}
+}
+
+func (m Marker) matches(res *Response, lowerBody []byte) bool {
+	contains := strings.ToLower(m.Contains)
+	if m.Header != "" {
+		for _, value := range res.Header.Values(m.Header) {
+			if strings.Contains(strings.ToLower(value), contains) {
+				return true
+			}
+		}
+		return false
+	}
+	return contains != "" && bytes.Contains(lowerBody, []byte(contains))
+}
+
+// A 200 response that was not the page asked for. It counts as transient, so the url goes
+// back through retry and backoff
+type PageError struct {
+	URL    string
+	Kind   PageKind
+	Marker Marker
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("%s page, found by its %s", e.Kind, e.Marker)
+}
+
+// Wraps a fetcher and turns responses that are not content into a *PageError, so they are
+// never cached, archived or handed to a scraper
+type ClassifyingFetcher struct {
+	Inner      Fetcher
+	Classifier Classifier
+}
+
+func (f *ClassifyingFetcher) IsLocal(webUrl string) bool {
+	local, ok := f.Inner.(LocalFetcher)
+	return ok && local.IsLocal(webUrl)
+}
+
+func (f *ClassifyingFetcher) Fetch(ctx context.Context, webUrl string) (*Response, error) {
+	return f.FetchWithHeader(ctx, webUrl, nil)
+}
+
+func (f *ClassifyingFetcher) FetchWithHeader(ctx context.Context, webUrl string, header http.Header) (*Response, error) {
+	var res *Response
+	var err error
+	if headerFetcher, ok := f.Inner.(HeaderFetcher); ok {
+		res, err = headerFetcher.FetchWithHeader(ctx, webUrl, header)
+	} else {
+		res, err = f.Inner.Fetch(ctx, webUrl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if kind, marker := f.Classifier.Classify(res); kind != PageContent {
+		return nil, &PageError{URL: webUrl, Kind: kind, Marker: marker}
+	}
+	return res, nil
+}
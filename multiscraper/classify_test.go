@@ -0,0 +1,93 @@
+package multiscraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		body   string
+		want   PageKind
+	}{
+		{"content", http.StatusOK, nil, "<title>AK-47 | Redline</title>", PageContent},
+		{"challenge header", http.StatusOK, http.Header{"Cf-Mitigated": {"Challenge"}}, "<html></html>", PageChallenge},
+		{"challenge title in any case", http.StatusOK, nil, "<TITLE>Just a moment...</TITLE>", PageChallenge},
+		{"maintenance", http.StatusOK, nil, "<p>We are down for maintenance</p>", PageMaintenance},
+		{"soft 404", http.StatusOK, nil, "<title>404 - csgostash</title>", PageNotFound},
+		// Kinds are checked in order, a challenge is dealt with before anything else
+		{"challenge over maintenance", http.StatusOK, nil, "<title>Maintenance</title><div class=cf-browser-verification>", PageChallenge},
+		// Other statuses speak for themselves
+		{"not a 200", http.StatusServiceUnavailable, nil, "<title>Just a moment...</title>", PageContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := test.header
+			if header == nil {
+				header = http.Header{}
+			}
+			kind, marker := DefaultClassifier.Classify(&Response{StatusCode: test.status, Header: header, Body: []byte(test.body)})
+			if kind != test.want {
+				t.Errorf("kind = %s by %s, want %s", kind, marker, test.want)
+			}
+			if (kind == PageContent) != (marker == Marker{}) {
+				t.Errorf("kind %s came with marker %s", kind, marker)
+			}
+		})
+	}
+}
+
+func TestLoadClassifierKeepsDefaultsOfMissingKinds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "markers.json")
+	if err := os.WriteFile(path, []byte(`{"soft_404": [{"contains": "nothing here"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	classifier, err := LoadClassifier(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind, _ := classifier.Classify(&Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte("Nothing here")}); kind != PageNotFound {
+		t.Errorf("custom marker gave %s", kind)
+	}
+	if kind, _ := classifier.Classify(&Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte("<title>404</title>")}); kind != PageContent {
+		t.Errorf("replaced default marker still gave %s", kind)
+	}
+	if kind, _ := classifier.Classify(&Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte("<title>Just a moment...</title>")}); kind != PageChallenge {
+		t.Errorf("default challenge marker gave %s", kind)
+	}
+}
+
+func TestChallengePagesAreRetried(t *testing.T) {
+	attempts := 0
+	inner := fetcherFunc(func(ctx context.Context, webUrl string) (*Response, error) {
+		attempts++
+		body := "<title>Just a moment...</title>"
+		if attempts > 1 {
+			body = "<title>Page</title>"
+		}
+		return &Response{URL: webUrl, StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(body)}, nil
+	})
+	fetcher := &ClassifyingFetcher{Inner: inner, Classifier: DefaultClassifier}
+
+	_, err := fetcher.Fetch(context.Background(), "http://site.example/page")
+	var pageErr *PageError
+	if !errors.As(err, &pageErr) || pageErr.Kind != PageChallenge {
+		t.Fatalf("challenge page gave %v, want a challenge error", err)
+	}
+
+	// Taken as transient, the url is tried again
+	attempts = 0
+	policy := DefaultRetryPolicy
+	policy.BaseDelay = 0
+	res, stats, err := fetchWithRetry(context.Background(), context.Background(), fetcher, "http://site.example/page", NewLimiter(LimiterConfig{PerSecond: 1000, Burst: 10}), policy, nil)
+	if err != nil || string(res.Body) != "<title>Page</title>" || stats.attempts != 2 {
+		t.Errorf("retried fetch = %v after %d attempts, want the page on the second", err, stats.attempts)
+	}
+}
@@ -0,0 +1,210 @@
+package multiscraper
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Settings for the http client shared by every request a HTTPFetcher makes
+type ClientConfig struct {
+	// Time allowed to open a tcp connection
+	DialTimeout time.Duration
+	// Time allowed for the tls handshake
+	TLSHandshakeTimeout time.Duration
+	// Time allowed between sending the request and receiving the response headers
+	ResponseHeaderTimeout time.Duration
+	// Time allowed for the whole request including reading the body, 0 for no limit
+	RequestTimeout time.Duration
+	// Bodies bigger than this fail with ErrBodyTooLarge, 0 for no limit
+	MaxResponseBytes int64
+	// Idle keep-alive connections kept open per host for reuse
+	MaxIdleConnsPerHost int
+	// Connections to a single host at once, including those in use, 0 for no limit
+	MaxConnsPerHost int
+	// How long an idle keep-alive connection is kept open
+	IdleConnTimeout time.Duration
+}
+
+var DefaultClientConfig = ClientConfig{
+	DialTimeout:           10 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: 20 * time.Second,
+	RequestTimeout:        60 * time.Second,
+	MaxResponseBytes:      16 << 20,
+	MaxIdleConnsPerHost:   32,
+	MaxConnsPerHost:       0,
+	IdleConnTimeout:       90 * time.Second,
+}
+
+// Returned when a response body is bigger than ClientConfig.MaxResponseBytes
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// Time taken by each phase of a request, phases that did not happen such as the dial of a
+// reused connection are 0
+type Timing struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// From sending the request until the first byte of the response
+	TimeToFirstByte time.Duration
+	// Whole request including reading the body
+	Total time.Duration
+	// Whether the request went over a kept alive connection
+	Reused bool
+	// Protocol the response came over, such as HTTP/2.0
+	Protocol string
+}
+
+func (t Timing) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		DNS             float64 `json:"dns_ms"`
+		Connect         float64 `json:"connect_ms"`
+		TLS             float64 `json:"tls_ms"`
+		TimeToFirstByte float64 `json:"ttfb_ms"`
+		Total           float64 `json:"total_ms"`
+		Reused          bool    `json:"reused"`
+		Protocol        string  `json:"protocol"`
+	}{
+		DNS:             milliseconds(t.DNS),
+		Connect:         milliseconds(t.Connect),
+		TLS:             milliseconds(t.TLS),
+		TimeToFirstByte: milliseconds(t.TimeToFirstByte),
+		Total:           milliseconds(t.Total),
+		Reused:          t.Reused,
+		Protocol:        t.Protocol,
+	})
+}
+
+// Build a client with pooled keep-alive connections that negotiates HTTP/2 where the server
+// supports it. Compression is handled by HTTPFetcher so that brotli works too
+func NewClient(config ClientConfig) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   config.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 proxyForRequest,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   config.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+		MaxIdleConns:          config.MaxIdleConnsPerHost * 4,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       config.MaxConnsPerHost,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		// A custom dialer turns off HTTP/2 unless it is asked for
+		ForceAttemptHTTP2:  true,
+		TLSClientConfig:    &tls.Config{MinVersion: tls.VersionTLS12},
+		DisableCompression: true,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   config.RequestTimeout,
+	}
+}
+
+// Accept-Encoding sent by HTTPFetcher, every encoding listed here is decoded by decodeBody
+const acceptEncoding = "br, gzip"
+
+// Wrap body in a decoder for the encoding the server used
+func decodeBody(body io.Reader, encoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "br":
+		return brotli.NewReader(body), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// Read a body, failing once more than max bytes have been read when max is above 0
+func readLimited(body io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return io.ReadAll(body)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, max)
+	}
+	return data, nil
+}
+
+// Timing of a request as its trace fills it in. The transport can call the trace from its own
+// goroutines, even after the response was handed back such as when a dial that lost the race
+// for the request completes, so every update is made under the mutex and none are taken once
+// the timing is frozen
+type timingTrace struct {
+	mtx    sync.Mutex
+	timing Timing
+	frozen bool
+
+	dnsStart, connectStart, tlsStart, requestDone time.Time
+}
+
+func (t *timingTrace) update(f func(t *timingTrace)) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if !t.frozen {
+		f(t)
+	}
+}
+
+// Stop taking updates and return the timing as it stands
+func (t *timingTrace) freeze() Timing {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.frozen = true
+	return t.timing
+}
+
+// Attach a trace to ctx that fills in the returned timing as the request goes through its phases
+func traceTiming(ctx context.Context) (context.Context, *timingTrace) {
+	trace := &timingTrace{}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			trace.update(func(t *timingTrace) { t.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			trace.update(func(t *timingTrace) { t.timing.DNS = time.Since(t.dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			trace.update(func(t *timingTrace) { t.connectStart = time.Now() })
+		},
+		ConnectDone: func(string, string, error) {
+			trace.update(func(t *timingTrace) { t.timing.Connect = time.Since(t.connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			trace.update(func(t *timingTrace) { t.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			trace.update(func(t *timingTrace) { t.timing.TLS = time.Since(t.tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			trace.update(func(t *timingTrace) { t.timing.Reused = info.Reused })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			trace.update(func(t *timingTrace) { t.requestDone = time.Now() })
+		},
+		GotFirstResponseByte: func() {
+			trace.update(func(t *timingTrace) { t.timing.TimeToFirstByte = time.Since(t.requestDone) })
+		},
+	}), trace
+}
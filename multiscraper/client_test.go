@@ -0,0 +1,118 @@
+package multiscraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func encode(t *testing.T, encoding string, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		return []byte(body)
+	}
+	if _, err := w.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Server answering every request with body in the given encoding
+func encodingServer(t *testing.T, encoding string, body string) *httptest.Server {
+	encoded := encode(t, encoding, body)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != acceptEncoding {
+			t.Errorf("Accept-Encoding = %q", r.Header.Get("Accept-Encoding"))
+		}
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		w.Write(encoded)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPFetcherDecodesBodies(t *testing.T) {
+	body := strings.Repeat("<p>page</p>", 100)
+	for _, encoding := range []string{"", "gzip", "br"} {
+		name := encoding
+		if name == "" {
+			name = "identity"
+		}
+		t.Run(name, func(t *testing.T) {
+			server := encodingServer(t, encoding, body)
+			res, err := NewHTTPFetcher(DefaultClientConfig).Fetch(context.Background(), server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(res.Body) != body {
+				t.Errorf("body = %q", res.Body)
+			}
+			if res.Header.Get("Content-Encoding") != "" {
+				t.Error("decoded response still names its encoding")
+			}
+			if res.Timing == nil || res.Timing.Protocol != "HTTP/1.1" || res.Timing.Total <= 0 {
+				t.Errorf("timing = %+v", res.Timing)
+			}
+		})
+	}
+}
+
+func TestHTTPFetcherCapsBodies(t *testing.T) {
+	config := DefaultClientConfig
+	config.MaxResponseBytes = 100
+	tests := []struct {
+		encoding string
+		size     int
+		tooLarge bool
+	}{
+		{"", 100, false},
+		{"", 101, true},
+		// The cap is on the decoded body, so a small compressed body can still be too large
+		{"gzip", 100, false},
+		{"gzip", 10000, true},
+		{"br", 10000, true},
+	}
+	for _, test := range tests {
+		server := encodingServer(t, test.encoding, strings.Repeat("a", test.size))
+		_, err := NewHTTPFetcher(config).Fetch(context.Background(), server.URL)
+		if tooLarge := errors.Is(err, ErrBodyTooLarge); tooLarge != test.tooLarge {
+			t.Errorf("%d bytes of %q: err = %v, want too large %t", test.size, test.encoding, err, test.tooLarge)
+		}
+	}
+}
+
+func TestTimingIgnoresLateCallbacks(t *testing.T) {
+	ctx, trace := traceTiming(context.Background())
+	callbacks := httptrace.ContextClientTrace(ctx)
+	callbacks.GotConn(httptrace.GotConnInfo{Reused: true})
+	timing := trace.freeze()
+
+	// Such as a dial that lost the race for the request finishing afterwards
+	callbacks.ConnectStart("tcp", "site.example:443")
+	callbacks.ConnectDone("tcp", "site.example:443", nil)
+	callbacks.GotConn(httptrace.GotConnInfo{Reused: false})
+	if later := trace.freeze(); later != timing || !later.Reused || later.Connect != 0 {
+		t.Errorf("timing changed after being frozen: %+v, then %+v", timing, later)
+	}
+}
@@ -0,0 +1,183 @@
+package multiscraper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// What happens when a scraper gives an item under a key another item already has
+type CollisionPolicy int
+
+const (
+	// Drop the later item, mark the url it came from as failed and fail the run
+	CollisionFail CollisionPolicy = iota
+	// Drop the later item and warn about it
+	CollisionKeepFirst
+	// Store the later item under the key with -2, -3 and so on appended and warn about it
+	CollisionSuffix
+)
+
+func (p CollisionPolicy) String() string {
+	switch p {
+	case CollisionFail:
+		return "fail"
+	case CollisionKeepFirst:
+		return "keep-first"
+	case CollisionSuffix:
+		return "suffix"
+	default:
+		return "unknown"
+	}
+}
+
+func (p CollisionPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// Lets a policy be given as a flag.Value
+func (p *CollisionPolicy) Set(name string) error {
+	policy, err := ParseCollisionPolicy(name)
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+// Policy from its name as given by String
+func ParseCollisionPolicy(name string) (CollisionPolicy, error) {
+	for _, policy := range []CollisionPolicy{CollisionFail, CollisionKeepFirst, CollisionSuffix} {
+		if strings.EqualFold(name, policy.String()) {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown collision policy %q, expected fail, keep-first or suffix", name)
+}
+
+// Where an item stored under a key came from
+type KeyOwner struct {
+	URL  string `json:"url"`
+	Name string `json:"name"`
+}
+
+// Two different items given under the same key
+type Collision struct {
+	Key    string          `json:"key"`
+	First  KeyOwner        `json:"first"`
+	Second KeyOwner        `json:"second"`
+	Policy CollisionPolicy `json:"policy"`
+	// Key the second item was stored under, empty when it was dropped
+	StoredAs string `json:"stored_as,omitempty"`
+}
+
+func (c Collision) String() string {
+	message := fmt.Sprintf("key %q of %q from %s is already taken by %q from %s", c.Key, c.Second.Name, c.Second.URL, c.First.Name, c.First.URL)
+	if c.StoredAs != "" {
+		return message + fmt.Sprintf(", stored as %q", c.StoredAs)
+	}
+	return message + ", dropped"
+}
+
+// Which item owns every key stored during a run. Must be used with the run's mutex held
+type keyOwners struct {
+	policy CollisionPolicy
+	owners map[string]KeyOwner
+}
+
+func newKeyOwners(policy CollisionPolicy) *keyOwners {
+	return &keyOwners{policy: policy, owners: make(map[string]KeyOwner)}
+}
+
+func (k *keyOwners) clone() *keyOwners {
+	owners := make(map[string]KeyOwner, len(k.owners))
+	for key, owner := range k.owners {
+		owners[key] = owner
+	}
+	return &keyOwners{policy: k.policy, owners: owners}
+}
+
+// Claim key for an item, returning the key to store it under or "" if it should be dropped.
+// The same item seen again, such as on two pages of a listing, is not a collision and takes
+// the key over as before. Items are the same when their names match, or their urls when they
+// have no name
+func (k *keyOwners) claim(key string, owner KeyOwner) (string, *Collision) {
+	first, taken := k.owners[key]
+	if !taken || sameItem(first, owner) {
+		k.owners[key] = owner
+		return key, nil
+	}
+	collision := &Collision{Key: key, First: first, Second: owner, Policy: k.policy}
+	if k.policy == CollisionSuffix {
+		for n := 2; ; n++ {
+			suffixed := fmt.Sprintf("%s-%d", key, n)
+			existing, taken := k.owners[suffixed]
+			if !taken || sameItem(existing, owner) {
+				k.owners[suffixed] = owner
+				collision.StoredAs = suffixed
+				break
+			}
+		}
+	}
+	return collision.StoredAs, collision
+}
+
+func sameItem(a KeyOwner, b KeyOwner) bool {
+	if a.Name != "" || b.Name != "" {
+		return a.Name == b.Name
+	}
+	return a.URL == b.URL
+}
+
+// A collision along with the index of the url the second item came from
+type pageCollision struct {
+	index int
+	Collision
+}
+
+// What storing the items scraped during a run came to
+type mergeOutcome struct {
+	collisions []pageCollision
+	// Items stored from each url, by index
+	stored map[int]int
+	// Urls that had an item dropped by CollisionFail, by index
+	collided map[int]bool
+}
+
+// Store the items scraped from every url in result. Urls are gone through in a fixed order, those
+// MultiScrape was given in the order they were given and then those scrapers queued sorted, so
+// which of two items under the same key wins does not depend on which page a parser got to
+// first. Keys owned by items of a resumed checkpoint were claimed before any of them. Must be
+// called with the mutex guarding run held
+func mergeScraped[T any](run *Result, inputs int, scraped map[int][]Keyed[T], owners *keyOwners, result map[string]T) mergeOutcome {
+	order := make([]int, 0, len(scraped))
+	for index := range scraped {
+		order = append(order, index)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if a < inputs || b < inputs {
+			return a < b
+		}
+		return run.URLs[a].URL < run.URLs[b].URL
+	})
+
+	outcome := mergeOutcome{stored: make(map[int]int), collided: make(map[int]bool)}
+	for _, index := range order {
+		for _, keyed := range scraped[index] {
+			key, collision := owners.claim(keyed.Key, KeyOwner{URL: run.URLs[index].URL, Name: keyed.Name})
+			if collision != nil {
+				outcome.collisions = append(outcome.collisions, pageCollision{index: index, Collision: *collision})
+				if collision.Policy == CollisionFail {
+					outcome.collided[index] = true
+				}
+				if key == "" {
+					continue
+				}
+			}
+			result[key] = keyed.Item
+			outcome.stored[index]++
+		}
+	}
+	return outcome
+}
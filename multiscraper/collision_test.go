@@ -0,0 +1,172 @@
+package multiscraper
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClaim(t *testing.T) {
+	first := KeyOwner{URL: "http://a/1", Name: "AK-47 | Redline"}
+	other := KeyOwner{URL: "http://a/2", Name: "AK-47 | Red Line"}
+	tests := []struct {
+		policy   CollisionPolicy
+		wantKey  string
+		storedAs string
+	}{
+		{CollisionFail, "", ""},
+		{CollisionKeepFirst, "", ""},
+		{CollisionSuffix, "ak47 redline-2", "ak47 redline-2"},
+	}
+	for _, test := range tests {
+		owners := newKeyOwners(test.policy)
+		if key, collision := owners.claim("ak47 redline", first); key != "ak47 redline" || collision != nil {
+			t.Fatalf("%s: first claim = %q, %v", test.policy, key, collision)
+		}
+		// The same item from another page of a listing is not a collision
+		if key, collision := owners.claim("ak47 redline", KeyOwner{URL: "http://a/listing?page=2", Name: first.Name}); key != "ak47 redline" || collision != nil {
+			t.Errorf("%s: same item again = %q, %v", test.policy, key, collision)
+		}
+		key, collision := owners.claim("ak47 redline", other)
+		if key != test.wantKey {
+			t.Errorf("%s: key = %q, want %q", test.policy, key, test.wantKey)
+		}
+		if collision == nil {
+			t.Fatalf("%s: no collision", test.policy)
+		}
+		if collision.First.Name != first.Name || collision.Second != other || collision.StoredAs != test.storedAs || collision.Policy != test.policy {
+			t.Errorf("%s: collision = %+v", test.policy, collision)
+		}
+	}
+
+	// Suffixes keep counting up, and an item seen again keeps its suffix
+	owners := newKeyOwners(CollisionSuffix)
+	owners.claim("key", KeyOwner{Name: "a"})
+	owners.claim("key", KeyOwner{Name: "b"})
+	if key, _ := owners.claim("key", KeyOwner{Name: "c"}); key != "key-3" {
+		t.Errorf("third item stored as %q, want key-3", key)
+	}
+	if key, _ := owners.claim("key", KeyOwner{Name: "b"}); key != "key-2" {
+		t.Errorf("second item seen again stored as %q, want key-2", key)
+	}
+
+	// Unnamed items are told apart by their urls
+	owners = newKeyOwners(CollisionFail)
+	owners.claim("key", KeyOwner{URL: "http://a/1"})
+	if _, collision := owners.claim("key", KeyOwner{URL: "http://a/1"}); collision != nil {
+		t.Errorf("unnamed item from the same url collided: %s", collision)
+	}
+	if _, collision := owners.claim("key", KeyOwner{URL: "http://a/2"}); collision == nil {
+		t.Error("unnamed items from different urls did not collide")
+	}
+}
+
+func TestMergeOrder(t *testing.T) {
+	run := &Result{URLs: []URLResult{{URL: "http://a/2"}, {URL: "http://a/1"}, {URL: "http://a/z"}, {URL: "http://a/b"}}}
+	item := func(name string) []Keyed[string] {
+		return []Keyed[string]{{Key: "key", Name: name, Item: name}}
+	}
+	scraped := map[int][]Keyed[string]{0: item("input 0"), 1: item("input 1"), 2: item("queued z"), 3: item("queued b")}
+
+	result := make(map[string]string)
+	outcome := mergeScraped(run, 2, scraped, newKeyOwners(CollisionSuffix), result)
+	// Given urls in the order given, then queued urls by url
+	want := map[string]string{"key": "input 0", "key-2": "input 1", "key-3": "queued b", "key-4": "queued z"}
+	for key, name := range want {
+		if result[key] != name {
+			t.Errorf("result[%q] = %q, want %q", key, result[key], name)
+		}
+	}
+	if len(outcome.collisions) != 3 || len(outcome.collided) != 0 {
+		t.Errorf("collisions = %d, collided = %d, want 3 and 0", len(outcome.collisions), len(outcome.collided))
+	}
+
+	result = make(map[string]string)
+	outcome = mergeScraped(run, 2, scraped, newKeyOwners(CollisionFail), result)
+	if result["key"] != "input 0" || len(result) != 1 {
+		t.Errorf("result = %v, want only input 0", result)
+	}
+	if !outcome.collided[1] || !outcome.collided[2] || !outcome.collided[3] || outcome.collided[0] {
+		t.Errorf("collided = %v, want every url but the first", outcome.collided)
+	}
+}
+
+// Pages whose body is the name of the one item on them, all under the same key
+func collidingPages(names ...string) (MapFetcher, []string) {
+	pages := make(map[string]string)
+	var urls []string
+	for i, name := range names {
+		webUrl := fmt.Sprintf("http://site.example/%d", i)
+		pages[webUrl] = name
+		urls = append(urls, webUrl)
+	}
+	return NewMapFetcher(pages), urls
+}
+
+func scrapeName(page *Page) ([]Keyed[string], []error) {
+	name := strings.TrimSpace(page.Text())
+	return []Keyed[string]{{Key: "key", Name: name, Item: name}}, nil
+}
+
+func TestCollisionFailFailsRun(t *testing.T) {
+	fetcher, urls := collidingPages("first", "second", "first")
+	opts := DefaultOptions
+	opts.Fetcher = fetcher
+	opts.Collisions = CollisionFail
+	result := make(map[string]string)
+	run := MultiScrape[string](context.Background(), urls, result, opts, ScraperFunc[string](scrapeName))
+
+	if run.Status != StatusFailed {
+		t.Errorf("status = %s, want failed", run.Status)
+	}
+	if result["key"] != "first" {
+		t.Errorf("result = %v, want the item of the first url", result)
+	}
+	states := []URLState{URLScraped, URLFailed, URLScraped}
+	for i, state := range states {
+		if run.URLs[i].State != state {
+			t.Errorf("url %d state = %s, want %s", i, run.URLs[i].State, state)
+		}
+	}
+	if len(run.Collisions) != 1 || run.Collisions[0].First.URL != urls[0] || run.Collisions[0].Second.URL != urls[1] {
+		t.Errorf("collisions = %+v", run.Collisions)
+	}
+
+	opts.Collisions = CollisionKeepFirst
+	run = MultiScrape[string](context.Background(), urls, make(map[string]string), opts, ScraperFunc[string](scrapeName))
+	if run.Status != StatusComplete {
+		t.Errorf("status under keep-first = %s, want complete", run.Status)
+	}
+}
+
+func TestResumedOwnersStillCollide(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	fetcher, urls := collidingPages("first", "second")
+	opts := DefaultOptions
+	opts.Fetcher = fetcher
+	opts.Collisions = CollisionFail
+	opts.Checkpoint = CheckpointOptions{Path: path, Resume: true}
+
+	// Only the first url gets scraped before the run stops
+	run := MultiScrape[string](context.Background(), urls[:1], make(map[string]string), opts, ScraperFunc[string](scrapeName))
+	if run.Status != StatusComplete {
+		t.Fatalf("first run status = %s", run.Status)
+	}
+
+	result := make(map[string]string)
+	run = MultiScrape[string](context.Background(), urls, result, opts, ScraperFunc[string](scrapeName))
+	if !run.URLs[0].Resumed {
+		t.Error("first url was scraped again")
+	}
+	if run.Status != StatusFailed || len(run.Collisions) != 1 {
+		t.Fatalf("status = %s with %d collisions, want failed with 1", run.Status, len(run.Collisions))
+	}
+	if collision := run.Collisions[0]; collision.First.URL != urls[0] || collision.First.Name != "first" {
+		t.Errorf("collision with %+v, want the owner from the checkpoint", collision.First)
+	}
+	if result["key"] != "first" {
+		t.Errorf("result = %v, want the resumed item", result)
+	}
+}
@@ -0,0 +1,239 @@
+package multiscraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A fetched page. Fetchers return any response they get, it is up to MultiScrape to decide
+// what a non 200 status means
+type Response struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Served by a CachingFetcher without downloading the page again
+	FromCache bool
+	// Set by a WARCFetcher, or by a CachingFetcher serving a page a WARCFetcher archived. Copied
+	// onto every Sourced item scraped from the page
+	Source *Source
+	// Set by a HTTPFetcher for responses that came over the network
+	Timing *Timing
+	// Headers the request was sent with and the protocol it was answered over, such as
+	// HTTP/2.0. Set by a HTTPFetcher
+	RequestHeader http.Header
+	Proto         string
+	// Proxy the request went through, with any password removed
+	Proxy string
+}
+
+// Source of pages for MultiScrape. An error means no response was received at all
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (*Response, error)
+}
+
+// Fetches pages over the network
+type HTTPFetcher struct {
+	// Client used for requests, http.DefaultClient if nil. Sharing one client between every
+	// request lets connections be reused
+	Client    *http.Client
+	UserAgent string
+	// Picked from at random for every request instead of UserAgent when not empty
+	UserAgents []string
+	// Requests are spread over these proxies when set, the client must come from NewClient
+	Proxies *ProxyPool
+	// Bodies bigger than this fail with ErrBodyTooLarge, 0 for no limit
+	MaxResponseBytes int64
+}
+
+// Names RobotsUserAgent, so the robots.txt group we follow is the one for the agent we send
+var DefaultUserAgent = "Mozilla/5.0 (compatible; gocasesapi/1.0)"
+
+func NewHTTPFetcher(config ClientConfig) *HTTPFetcher {
+	return &HTTPFetcher{
+		Client:           NewClient(config),
+		UserAgent:        DefaultUserAgent,
+		MaxResponseBytes: config.MaxResponseBytes,
+	}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, webUrl string) (*Response, error) {
+	return f.FetchWithHeader(ctx, webUrl, nil)
+}
+
+func (f *HTTPFetcher) FetchWithHeader(ctx context.Context, webUrl string, header http.Header) (*Response, error) {
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var proxy *proxyState
+	if f.Proxies != nil {
+		proxy = f.Proxies.pick()
+		ctx = withProxy(ctx, proxy.url)
+	}
+	tracedCtx, trace := traceTiming(ctx)
+	req, err := http.NewRequestWithContext(tracedCtx, "GET", webUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if userAgent := pickUserAgent(f.UserAgents, f.UserAgent); userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		if proxy != nil && ctx.Err() == nil {
+			f.Proxies.report(proxy, time.Since(start), true)
+		}
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := readBody(res, f.MaxResponseBytes)
+	// Callbacks still to come from the transport are no longer about this response
+	timing := trace.freeze()
+	timing.Total = time.Since(start)
+	if proxy != nil && ctx.Err() == nil {
+		f.Proxies.report(proxy, timing.Total, proxyFailed(res.StatusCode, err))
+	}
+	if err != nil {
+		return nil, err
+	}
+	timing.Protocol = res.Proto
+
+	// The body is handed out decoded, so the headers describing the encoding no longer apply
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	return &Response{
+		URL:           webUrl,
+		StatusCode:    res.StatusCode,
+		Header:        res.Header,
+		Body:          body,
+		Timing:        &timing,
+		RequestHeader: req.Header.Clone(),
+		Proto:         res.Proto,
+		Proxy:         proxyName(proxy),
+	}, nil
+}
+
+func readBody(res *http.Response, max int64) ([]byte, error) {
+	decoded, err := decodeBody(res.Body, res.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	return readLimited(decoded, max)
+}
+
+// Serves pages from memory keyed by url, urls without an entry get a 404. Meant for tests
+type MapFetcher map[string]*Response
+
+// Build a MapFetcher answering every url with a 200 and the given body
+func NewMapFetcher(pages map[string]string) MapFetcher {
+	fetcher := make(MapFetcher, len(pages))
+	for webUrl, body := range pages {
+		fetcher[webUrl] = &Response{
+			URL:        webUrl,
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+			Body:       []byte(body),
+		}
+	}
+	return fetcher
+}
+
+func (f MapFetcher) IsLocal(webUrl string) bool {
+	return true
+}
+
+func (f MapFetcher) Fetch(ctx context.Context, webUrl string) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	res, ok := f[webUrl]
+	if !ok {
+		return notFound(webUrl), nil
+	}
+	return res, nil
+}
+
+// Serves pages from files laid out as Root/host/path, see DirFetcher.Path. Urls without a
+// file get a 404
+type DirFetcher struct {
+	Root string
+}
+
+// File a url is read from. Paths ending in a slash map to index.html and a query string is
+// appended to the file name, so csgostash.com/stickers/regular?page=2 is read from
+// Root/csgostash.com/stickers/regular?page=2.html. Urls whose host or path would lead out of
+// the directory of their host, such as through "..", are refused
+func (f DirFetcher) Path(webUrl string) (string, error) {
+	parsed, err := url.Parse(webUrl)
+	if err != nil {
+		return "", err
+	}
+	host := parsed.Host
+	if host == "" || host == "." || host == ".." || strings.ContainsAny(host, `/\`) {
+		return "", fmt.Errorf("no directory for the host of %s", webUrl)
+	}
+	name := parsed.Path
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index"
+	}
+	if parsed.RawQuery != "" {
+		name += "?" + parsed.RawQuery
+	}
+	name += ".html"
+	dir := filepath.Join(f.Root, host)
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s leads out of %s", webUrl, dir)
+	}
+	return path, nil
+}
+
+func (f DirFetcher) IsLocal(webUrl string) bool {
+	return true
+}
+
+func (f DirFetcher) Fetch(ctx context.Context, webUrl string) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path, err := f.Path(webUrl)
+	if err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return notFound(webUrl), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		URL:        webUrl,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:       body,
+	}, nil
+}
+
+func notFound(webUrl string) *Response {
+	return &Response{
+		URL:        webUrl,
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{},
+	}
+}
@@ -0,0 +1,60 @@
+package multiscraper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirFetcherPath(t *testing.T) {
+	root := t.TempDir()
+	fetcher := DirFetcher{Root: root}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://csgostash.com/stickers/regular?page=2", "csgostash.com/stickers/regular?page=2.html"},
+		{"https://csgostash.com/", "csgostash.com/index.html"},
+		{"https://csgostash.com", "csgostash.com/index.html"},
+		// Dot segments that stay inside the host are fine
+		{"https://csgostash.com/a/../b", "csgostash.com/b.html"},
+	}
+	for _, test := range tests {
+		got, err := fetcher.Path(test.url)
+		if err != nil {
+			t.Errorf("Path(%q) = %s", test.url, err)
+			continue
+		}
+		if want := filepath.Join(root, filepath.FromSlash(test.want)); got != want {
+			t.Errorf("Path(%q) = %q, want %q", test.url, got, want)
+		}
+	}
+
+	for _, webUrl := range []string{
+		"https://csgostash.com/../secret",
+		"https://csgostash.com/../../etc/passwd",
+		"https://csgostash.com/a/../../other.com/page",
+		"https://../secret",
+		"/no/host",
+	} {
+		if got, err := fetcher.Path(webUrl); err == nil {
+			t.Errorf("Path(%q) = %q, want an error", webUrl, got)
+		}
+	}
+}
+
+func TestDirFetcherStaysInRoot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secret.html"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "pages")
+	if err := os.MkdirAll(filepath.Join(root, "site.example"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	res, err := DirFetcher{Root: root}.Fetch(context.Background(), "https://site.example/../../secret")
+	if err == nil {
+		t.Errorf("fetched %q from outside the root", res.Body)
+	}
+}
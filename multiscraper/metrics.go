@@ -0,0 +1,229 @@
+package multiscraper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prometheus metrics of every run given them, served in the text exposition format. A nil
+// *Metrics records nothing
+type Metrics struct {
+	mtx           sync.Mutex
+	requests      *counterVec
+	fetchDuration *histogramVec
+	parseErrors   *counterVec
+	items         *counterVec
+	limiterWait   *histogramVec
+	runs          *counterVec
+	families      []family
+}
+
+var (
+	fetchBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	waitBuckets  = []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 5, 30, 60}
+)
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		requests:      newCounterVec("gocasesapi_requests_total", "Requests made, by host and response status, error when there was no response", "host", "status"),
+		fetchDuration: newHistogramVec("gocasesapi_fetch_duration_seconds", "Time taken by each request, by host", fetchBuckets, "host"),
+		parseErrors:   newCounterVec("gocasesapi_parse_errors_total", "Errors parsing pages or returned by scrapers, by category and the scraper that gave them", "category", "callback"),
+		items:         newCounterVec("gocasesapi_items_total", "Items stored, by category", "category"),
+		limiterWait:   newHistogramVec("gocasesapi_limiter_wait_seconds", "Time spent waiting on the rate limiter before each request, by host", waitBuckets, "host"),
+		runs:          newCounterVec("gocasesapi_runs_total", "Runs of every scrape, by whether they succeeded", "outcome"),
+	}
+	m.families = []family{m.requests, m.fetchDuration, m.parseErrors, m.items, m.limiterWait, m.runs}
+	return m
+}
+
+func (m *Metrics) observeRequest(webUrl string, statusCode int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	status := "error"
+	if statusCode != 0 {
+		status = strconv.Itoa(statusCode)
+	}
+	host := hostOf(webUrl)
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.requests.add(1, host, status)
+	m.fetchDuration.observe(elapsed.Seconds(), host)
+}
+
+func (m *Metrics) observeWait(webUrl string, waited time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.limiterWait.observe(waited.Seconds(), hostOf(webUrl))
+}
+
+func (m *Metrics) addParseErrors(category string, callback string, n int) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.parseErrors.add(float64(n), category, callback)
+}
+
+func (m *Metrics) addItems(category string, n int) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.items.add(float64(n), category)
+}
+
+// Count a whole run of every scrape, for alerting on scheduled runs that keep failing
+func (m *Metrics) ObserveRun(succeeded bool) {
+	if m == nil {
+		return
+	}
+	outcome := "failure"
+	if succeeded {
+		outcome = "success"
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.runs.add(1, outcome)
+}
+
+// Serve the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// Write the metrics in the Prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	m.mtx.Lock()
+	for _, family := range m.families {
+		family.write(&b)
+	}
+	m.mtx.Unlock()
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+type family interface {
+	write(b *strings.Builder)
+}
+
+// Label values joined by a byte that never appears in utf-8 text
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names []string, values []string, extra ...string) string {
+	pairs := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]float64
+	keys   map[string][]string
+}
+
+func newCounterVec(name string, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64), keys: make(map[string][]string)}
+}
+
+func (c *counterVec) add(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	c.values[key] += v
+	c.keys[key] = labelValues
+}
+
+func (c *counterVec) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(b, "%s%s %s\n", c.name, formatLabels(c.labels, c.keys[key]), formatFloat(c.values[key]))
+	}
+}
+
+type histogram struct {
+	labelValues []string
+	// Observations at or below each bucket's upper bound
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	values  map[string]*histogram
+}
+
+func newHistogramVec(name string, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += v
+	hist.count++
+}
+
+func (h *histogramVec) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.values) {
+		hist := h.values[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, hist.labelValues, "le", formatFloat(bound)), hist.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, hist.labelValues, "le", "+Inf"), hist.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", h.name, formatLabels(h.labels, hist.labelValues), formatFloat(hist.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", h.name, formatLabels(h.labels, hist.labelValues), hist.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,52 @@
+package multiscraper
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func failingScraper(page *Page) ([]Keyed[string], []error) {
+	return []Keyed[string]{{Key: "key", Item: "item"}}, []error{errors.New("no price"), errors.New("no image")}
+}
+
+func TestScraperName(t *testing.T) {
+	if got := scraperName[string](ScraperFunc[string](failingScraper)); got != "multiscraper.failingScraper" {
+		t.Errorf("name of a ScraperFunc = %q", got)
+	}
+	if got := scraperName[string](testScraper{}); got != "multiscraper.testScraper" {
+		t.Errorf("name of a Scraper type = %q", got)
+	}
+}
+
+type testScraper struct{}
+
+func (testScraper) Scrape(page *Page) ([]Keyed[string], []error) {
+	return nil, nil
+}
+
+func TestMetricsOfRun(t *testing.T) {
+	opts := DefaultOptions
+	opts.Name = "skins"
+	opts.Metrics = NewMetrics()
+	opts.Fetcher = NewMapFetcher(map[string]string{"http://site.example/1": "page"})
+	MultiScrape[string](context.Background(), []string{"http://site.example/1"}, map[string]string{}, opts, ScraperFunc[string](failingScraper))
+	opts.Metrics.ObserveRun(true)
+
+	var out strings.Builder
+	if _, err := opts.Metrics.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`gocasesapi_requests_total{host="site.example",status="200"} 1`,
+		`gocasesapi_parse_errors_total{category="skins",callback="multiscraper.failingScraper"} 2`,
+		`gocasesapi_items_total{category="skins"} 1`,
+		`gocasesapi_fetch_duration_seconds_count{host="site.example"} 1`,
+		`gocasesapi_runs_total{outcome="success"} 1`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("metrics are missing %s\n%s", line, out.String())
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package multiscraper
 
 import (
-	"net/http"
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"runtime"
 	"sync"
 	"time"
 
@@ -10,106 +14,411 @@ import (
 	"github.com/PuerkitoBio/goquery"
 )
 
-// Multithreaded spawning of goroutines for scraping urls using  a fixed rate of documents
-// per second
-func MultiScrape[T any](urls []string, result map[string]T, perSecond int, callback func(*sync.Mutex, *goquery.Document, map[string]T)) {
-	var wg sync.WaitGroup
-	var scrapeWg sync.WaitGroup
+// How long requests and scrapers already in flight are given to finish once the
+// context passed to MultiScrape has been cancelled
+var ShutdownGrace = 10 * time.Second
+
+// Settings for a MultiScrape run
+type Options struct {
+	// What the run scrapes, such as skins, used to label its progress and metrics
+	Name string
+	// Where pages come from, a HTTPFetcher with the default client settings if nil
+	Fetcher Fetcher
+	// Limiter shared between runs, if nil each run gets its own limiter allowing PerSecond
+	// requests per second to every host
+	Limiter *Limiter
+	// Number of requests per second for the limiter created when Limiter is nil
+	PerSecond int
+	// Number of goroutines fetching pages, which caps how many requests are in flight at once
+	Fetchers int
+	// Number of goroutines parsing pages and running the scraper, fetchers block once every
+	// parser is busy and the hand off queue is full
+	Parsers    int
+	Retry      RetryPolicy
+	Checkpoint CheckpointOptions
+	// Checked before every url is requested, urls its robots.txt disallows are not fetched
+	Robots *Robots
+	// What to do with an item given under a key another item of the run already has. Which
+	// item comes first does not depend on timing, see mergeScraped
+	Collisions CollisionPolicy
+	// Where the run shows how far along it is, nothing is shown if nil
+	Progress *Progress
+	// Where the run records its metrics, nothing is recorded if nil
+	Metrics *Metrics
+}
+
+var DefaultOptions = Options{
+	PerSecond: 20,
+	Fetchers:  20,
+	Parsers:   runtime.NumCPU(),
+	Retry:     DefaultRetryPolicy,
+}
+
+// A successful response along with the index of the url it was requested for
+type fetchedPage struct {
+	index    int
+	response *Response
+}
+
+// Scrape urls through a bounded pipeline: urls are handed to a pool of fetchers, which wait
+// on the rate limiter before every request and pass their responses to a pool of parsers
+// running the scraper. Cancelling ctx stops any new requests from being made, requests and
+// scrapers already in flight are given ShutdownGrace to finish before a partial status is
+// returned
+func MultiScrape[T any](ctx context.Context, urls []string, result map[string]T, opts Options, scraper Scraper[T]) Result {
 	var mtx sync.Mutex
 
-	requestsLeft := len(urls)
-	requestsMade := 0
-	var responses []*http.Response
+	// In flight requests outlive ctx by the grace period rather than being torn down instantly
+	requestCtx, cancelRequests := withGrace(ctx, ShutdownGrace)
+	defer cancelRequests()
 
-	go continuallyScrapePages(&mtx, &scrapeWg, &responses, result, requestsLeft, callback)
+	run := Result{URLs: make([]URLResult, len(urls))}
+	known := make(map[string]bool)
+	for i, webUrl := range urls {
+		run.URLs[i].URL = webUrl
+		known[webUrl] = true
+	}
 
-	for requestsLeft > 0 {
-		start := time.Now()
-		requestsToMake := 0
+	// Shared by every page so collisions between pages are caught
+	owners := newKeyOwners(opts.Collisions)
 
-		if requestsLeft < perSecond {
-			requestsToMake = requestsLeft
+	// Pick up where a previous run left off
+	done := make(map[string]bool)
+	var queued []string
+	if opts.Checkpoint.Path != "" && opts.Checkpoint.Resume {
+		checkpoint, err := loadCheckpoint[T](opts.Checkpoint.Path)
+		if err != nil {
+			log.Warning.Printf("Ignoring checkpoint %s: %s", opts.Checkpoint.Path, err)
+		} else if checkpoint != nil {
+			for key, item := range checkpoint.Result {
+				result[key] = item
+			}
+			for key, owner := range checkpoint.Owners {
+				owners.owners[key] = owner
+			}
+			for _, webUrl := range checkpoint.Done {
+				done[webUrl] = true
+			}
+			queued = checkpoint.URLs
+			log.Info.Printf("Resuming from %s saved at %s, %d urls already done", opts.Checkpoint.Path, checkpoint.SavedAt.Format(time.RFC3339), len(checkpoint.Done))
+		}
+	}
+	var pending []int
+	for i := range run.URLs {
+		if done[run.URLs[i].URL] {
+			run.URLs[i].State = URLScraped
+			run.URLs[i].Resumed = true
 		} else {
-			requestsToMake = perSecond
+			pending = append(pending, i)
 		}
+	}
+	queue := newURLQueue(pending)
+	progress := opts.Progress.Category(opts.Name)
+	progress.queue(len(pending))
+	defer progress.finish()
 
-		wg.Add(requestsToMake)
-		scrapeWg.Add(requestsToMake)
-
-		for i := 0; i < requestsToMake; i++ {
-			go makeConcurrentRequest(&wg, &mtx, urls[requestsMade+i], &requestsMade, &requestsLeft, &responses)
+	// Urls scrapers queue with Page.Enqueue, each is only ever scraped once
+	enqueue := func(urls []string) {
+		var indices []int
+		mtx.Lock()
+		for _, webUrl := range urls {
+			if known[webUrl] {
+				continue
+			}
+			known[webUrl] = true
+			run.URLs = append(run.URLs, URLResult{URL: webUrl})
+			if done[webUrl] {
+				run.URLs[len(run.URLs)-1].State = URLScraped
+				run.URLs[len(run.URLs)-1].Resumed = true
+			} else {
+				indices = append(indices, len(run.URLs)-1)
+			}
 		}
-
-		wg.Wait()
-		elapsed := time.Since(start)
-		time.Sleep((1000 - time.Duration(elapsed.Milliseconds())) * time.Millisecond)
+		mtx.Unlock()
+		progress.queue(len(indices))
+		queue.add(indices)
 	}
+	// Urls an earlier run had queued, pages that queued them may already be done and will not
+	// queue them again
+	enqueue(queued)
 
-	scrapeWg.Wait()
-}
+	limiter := opts.Limiter
+	if limiter == nil {
+		config := DefaultLimiterConfig
+		config.PerSecond = float64(atLeastOne(opts.PerSecond))
+		limiter = NewLimiter(config)
+	}
 
-func Http2Request(webUrl string) (*http.Response, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", webUrl, nil)
-	if err != nil {
-		return nil, err
+	fetcher := opts.Fetcher
+	if fetcher == nil {
+		fetcher = NewHTTPFetcher(DefaultClientConfig)
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/117.0")
 
-	res, err := client.Do(req)
+	jobs := make(chan int)
+	pages := make(chan fetchedPage, atLeastOne(opts.Parsers))
+
+	go queue.dispatch(ctx, jobs)
 
-	if err != nil || res.StatusCode != 200 {
-		return nil, err
+	var fetchWg sync.WaitGroup
+	fetchWg.Add(atLeastOne(opts.Fetchers))
+	for i := 0; i < atLeastOne(opts.Fetchers); i++ {
+		go func() {
+			defer fetchWg.Done()
+			fetchPages(ctx, requestCtx, &mtx, &run, fetcher, limiter, opts.Robots, opts.Retry, opts.Metrics, queue, progress, jobs, pages)
+		}()
 	}
-	return res, nil
-}
+	go func() {
+		fetchWg.Wait()
+		close(pages)
+	}()
 
-func makeConcurrentRequest(wg *sync.WaitGroup, mtx *sync.Mutex, webURL string, requestsMade *int, requestsLeft *int, outputResponses *[]*http.Response) {
-	defer wg.Done()
+	// Items of every page by url index, only stored in result once the run is over
+	scraped := make(map[int][]Keyed[T])
+	callback := scraperName(scraper)
+	var parseWg sync.WaitGroup
+	parseWg.Add(atLeastOne(opts.Parsers))
+	for i := 0; i < atLeastOne(opts.Parsers); i++ {
+		go func() {
+			defer parseWg.Done()
+			parsePages(&mtx, &run, scraped, queue, progress, opts.Metrics, opts.Name, callback, enqueue, pages, scraper)
+		}()
+	}
 
-	res, err := Http2Request(webURL)
+	// Wait for the pipeline to drain, but only for so long if we have been told to stop
+	scrapingDone := make(chan struct{})
+	go func() {
+		parseWg.Wait()
+		close(scrapingDone)
+	}()
+	if opts.Checkpoint.Path != "" {
+		// Merged into copies, storing items in result as the run goes would change their order
+		save := func() error {
+			snapshot := make(map[string]T, len(result))
+			for key, item := range result {
+				snapshot[key] = item
+			}
+			snapshotOwners := owners.clone()
+			outcome := mergeScraped(&run, len(urls), scraped, snapshotOwners, snapshot)
+			return saveCheckpoint(opts.Checkpoint.Path, &run, snapshot, snapshotOwners.owners, outcome.collided)
+		}
+		go checkpointPeriodically(opts.Checkpoint.Path, opts.Checkpoint.Interval, &mtx, save, scrapingDone)
+	}
+	select {
+	case <-scrapingDone:
+	case <-requestCtx.Done():
+		log.Warning.Println("Gave up waiting for in flight scrapers to finish")
+	}
 
-	if err != nil {
-		log.Error.Printf("%s", err.Error())
-		mtx.Lock()
-		defer mtx.Unlock()
-		*requestsMade += 1
-		*requestsLeft -= 1
-	} else {
-		mtx.Lock()
-		defer mtx.Unlock()
-		*requestsMade += 1
-		*requestsLeft -= 1
-		*outputResponses = append(*outputResponses, res)
+	mtx.Lock()
+	defer mtx.Unlock()
+	outcome := mergeScraped(&run, len(urls), scraped, owners, result)
+	stored := 0
+	for index, n := range outcome.stored {
+		run.URLs[index].Items = n
+		stored += n
 	}
+	opts.Metrics.addItems(opts.Name, stored)
+	for _, collision := range outcome.collisions {
+		run.Collisions = append(run.Collisions, collision.Collision)
+		urlResult := &run.URLs[collision.index]
+		message := "key collision: " + collision.String()
+		if collision.Policy == CollisionFail {
+			log.Error.Printf("Key collision: %s", collision.Collision)
+			urlResult.Errors = append(urlResult.Errors, message)
+			urlResult.State = URLFailed
+		} else {
+			log.Warning.Printf("Key collision: %s", collision.Collision)
+			urlResult.Warnings = append(urlResult.Warnings, message)
+		}
+	}
+
+	run.Status = StatusComplete
+	if ctx.Err() != nil {
+		run.Status = StatusPartial
+	}
+	if len(outcome.collided) > 0 {
+		run.Status = StatusFailed
+	}
+	if opts.Checkpoint.Path != "" {
+		if err := saveCheckpoint(opts.Checkpoint.Path, &run, result, owners.owners, nil); err != nil {
+			log.Warning.Printf("Could not save checkpoint %s: %s", opts.Checkpoint.Path, err)
+		}
+	}
+	finished := run
+	finished.URLs = append([]URLResult(nil), run.URLs...)
+	finished.Collisions = append([]Collision(nil), run.Collisions...)
+	return finished
 }
 
-// Goroutine that will continually scrape from an array http responses with a callback until it has scraped a certain amount of times
-func continuallyScrapePages[T any](mtx *sync.Mutex, scrapeWg *sync.WaitGroup, responses *[]*http.Response, result map[string]T, totalToScrape int, callback func(*sync.Mutex, *goquery.Document, map[string]T)) {
-	amountScraped := 0
-	for amountScraped != totalToScrape {
+// Fetcher worker, requests every url index it receives and passes successful responses on
+func fetchPages(ctx context.Context, requestCtx context.Context, mtx *sync.Mutex, run *Result, fetcher Fetcher, limiter *Limiter, robots *Robots, policy RetryPolicy, metrics *Metrics, queue *urlQueue, progress *ProgressCounter, jobs <-chan int, pages chan<- fetchedPage) {
+	for index := range jobs {
 		mtx.Lock()
-		lenResp := len(*responses)
+		webUrl := run.URLs[index].URL
 		mtx.Unlock()
-		if lenResp > amountScraped {
-			for i := 0; i < lenResp-amountScraped; i++ {
+
+		if robots != nil {
+			allowed, err := robots.Allowed(ctx, webUrl, limiter)
+			if err != nil && cancelled(ctx, err) {
+				// Cancelled while fetching robots.txt
+				progress.skip()
+				queue.finish()
+				continue
+			}
+			if err != nil {
+				log.Error.Printf("Checking robots.txt for %s: %s", webUrl, err)
 				mtx.Lock()
-				response := (*responses)[amountScraped+i]
-
-				if response.StatusCode == 200 {
-					doc, err := goquery.NewDocumentFromReader(response.Body)
-					if err != nil {
-						log.Error.Println(err)
-					}
-					go func() {
-						defer scrapeWg.Done()
-						callback(mtx, doc, result)
-					}()
-				}
-				response.Body.Close()
+				run.URLs[index].State = URLFailed
+				run.URLs[index].Err = err
+				mtx.Unlock()
+				progress.fail()
+				queue.finish()
+				continue
+			}
+			if !allowed {
+				log.Warning.Printf("Skipping %s, disallowed by robots.txt", webUrl)
+				mtx.Lock()
+				run.URLs[index].State = URLDisallowed
 				mtx.Unlock()
+				progress.skip()
+				queue.finish()
+				continue
 			}
-			amountScraped = lenResp
+		}
+
+		res, stats, err := fetchWithRetry(ctx, requestCtx, fetcher, webUrl, limiter, policy, metrics)
+		if stats.attempts == 0 {
+			// Cancelled while waiting on the limiter, the url was never requested
+			progress.skip()
+			queue.finish()
+			continue
+		}
+		// Cancelled between attempts or mid request, that says nothing about the url
+		skipped := err != nil && cancelled(ctx, err)
+
+		mtx.Lock()
+		urlResult := &run.URLs[index]
+		urlResult.Attempts = stats.attempts
+		urlResult.StatusCode = stats.statusCode
+		urlResult.FetchDuration = stats.duration
+		if res != nil {
+			urlResult.Bytes = len(res.Body)
+			urlResult.FromCache = res.FromCache
+			urlResult.Timing = res.Timing
+			urlResult.Proxy = res.Proxy
+		}
+		if err != nil && !skipped {
+			log.Error.Printf("%s", err.Error())
+			urlResult.State = URLFailed
+			urlResult.Err = err
+		}
+		mtx.Unlock()
+
+		if err == nil {
+			// The parser finishes it
+			progress.fetch()
+			pages <- fetchedPage{index: index, response: res}
+		} else if skipped {
+			progress.skip()
+			queue.finish()
+		} else {
+			progress.fail()
+			queue.finish()
 		}
 	}
 }
+
+// Parser worker, turns every response it receives into a document for the scraper
+func parsePages[T any](mtx *sync.Mutex, run *Result, scraped map[int][]Keyed[T], queue *urlQueue, progress *ProgressCounter, metrics *Metrics, name string, callback string, enqueue func([]string), pages <-chan fetchedPage, scraper Scraper[T]) {
+	for page := range pages {
+		start := time.Now()
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page.response.Body))
+		if err == nil {
+			// Lets scrapers resolve relative links
+			doc.Url, err = url.Parse(page.response.URL)
+		}
+		if err != nil {
+			log.Error.Println(err)
+			mtx.Lock()
+			run.URLs[page.index].State = URLFailed
+			run.URLs[page.index].Err = err
+			run.URLs[page.index].ParseDuration = time.Since(start)
+			mtx.Unlock()
+			metrics.addParseErrors(name, callback, 1)
+			progress.fail()
+			queue.finish()
+			continue
+		}
+
+		scrapedPage := NewPage(doc)
+		items, errs := scraper.Scrape(scrapedPage)
+		elapsed := time.Since(start)
+		enqueue(scrapedPage.Links())
+		errors := make([]string, 0, len(errs))
+		for _, err := range errs {
+			log.Error.Printf("Scraping %s: %s", page.response.URL, err)
+			errors = append(errors, err.Error())
+		}
+
+		if page.response.Source != nil {
+			for i := range items {
+				if sourced, ok := any(&items[i].Item).(Sourced); ok {
+					sourced.SetSource(page.response.Source)
+				}
+			}
+		}
+
+		mtx.Lock()
+		scraped[page.index] = items
+		urlResult := &run.URLs[page.index]
+		urlResult.ParseDuration = elapsed
+		urlResult.Warnings = scrapedPage.Warnings()
+		if len(errors) > 0 {
+			urlResult.Errors = errors
+		}
+		urlResult.State = URLScraped
+		if len(errors) > 0 && len(items) == 0 {
+			urlResult.State = URLFailed
+		}
+		state := urlResult.State
+		mtx.Unlock()
+		metrics.addParseErrors(name, callback, len(errs))
+		if state == URLFailed {
+			progress.fail()
+		} else {
+			progress.parse()
+		}
+		// Only now, so that urls the scraper queued keep the run going
+		queue.finish()
+	}
+}
+
+// Whether err came from the run being cancelled rather than from the url itself
+func cancelled(ctx context.Context, err error) bool {
+	return ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// Returns a context that outlives its parent by the given grace period, so work already in
+// flight when the parent is cancelled has a chance to finish
+func withGrace(parent context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-parent.Done():
+			select {
+			case <-time.After(grace):
+				cancel()
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
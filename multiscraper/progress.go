@@ -0,0 +1,314 @@
+package multiscraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How progress is shown
+type ProgressMode int
+
+const (
+	// A line when writing to a terminal, json events otherwise
+	ProgressAuto ProgressMode = iota
+	// A single line redrawn in place
+	ProgressLine
+	// A json object per line every interval, for logs that are read later
+	ProgressJSON
+	// Nothing at all
+	ProgressOff
+)
+
+func (m ProgressMode) String() string {
+	switch m {
+	case ProgressAuto:
+		return "auto"
+	case ProgressLine:
+		return "line"
+	case ProgressJSON:
+		return "json"
+	case ProgressOff:
+		return "off"
+	default:
+		return "unknown"
+	}
+}
+
+// Lets a mode be given as a flag.Value
+func (m *ProgressMode) Set(name string) error {
+	for _, mode := range []ProgressMode{ProgressAuto, ProgressLine, ProgressJSON, ProgressOff} {
+		if strings.EqualFold(name, mode.String()) {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown progress mode %q, expected auto, line, json or off", name)
+}
+
+// Counts for one category of urls, such as the skins of a run of main. A nil counter counts
+// nothing, so runs without progress reporting need no checks
+type ProgressCounter struct {
+	name     string
+	progress *Progress
+	// Unix nanoseconds of the first url queued
+	started  int64
+	counts   [countKinds]int64
+	finished int32
+}
+
+// What a url can be counted as, indexing ProgressCounter.counts
+const (
+	countQueued = iota
+	countFetched
+	countParsed
+	countFailed
+	countSkipped
+	countKinds
+)
+
+func (c *ProgressCounter) add(kind int, n int) {
+	if c == nil || n == 0 {
+		return
+	}
+	atomic.CompareAndSwapInt64(&c.started, 0, time.Now().UnixNano())
+	atomic.AddInt64(&c.counts[kind], int64(n))
+}
+
+func (c *ProgressCounter) count(kind int) int64 {
+	return atomic.LoadInt64(&c.counts[kind])
+}
+
+func (c *ProgressCounter) queue(n int) { c.add(countQueued, n) }
+func (c *ProgressCounter) fetch()      { c.add(countFetched, 1) }
+func (c *ProgressCounter) parse()      { c.add(countParsed, 1) }
+func (c *ProgressCounter) fail()       { c.add(countFailed, 1) }
+func (c *ProgressCounter) skip()       { c.add(countSkipped, 1) }
+
+// Mark the category as done, which sends its last event and takes it off the line
+func (c *ProgressCounter) finish() {
+	if c == nil || !atomic.CompareAndSwapInt32(&c.finished, 0, 1) {
+		return
+	}
+	c.progress.finished(c)
+}
+
+// Counts at one point in time along with the rate and ETA they work out to
+type ProgressEvent struct {
+	Event    string  `json:"event"`
+	Time     string  `json:"time"`
+	Category string  `json:"category"`
+	Queued   int64   `json:"queued"`
+	Fetched  int64   `json:"fetched"`
+	Parsed   int64   `json:"parsed"`
+	Failed   int64   `json:"failed"`
+	Skipped  int64   `json:"skipped"`
+	Elapsed  float64 `json:"elapsed_seconds"`
+	// Urls dealt with per second since the first was queued
+	PerSecond float64 `json:"per_second"`
+	// Seconds until every queued url is dealt with at the current rate, -1 when unknown
+	ETA  float64 `json:"eta_seconds"`
+	Done bool    `json:"done"`
+}
+
+func (c *ProgressCounter) snapshot(now time.Time) ProgressEvent {
+	event := ProgressEvent{
+		Event:    "progress",
+		Time:     now.UTC().Format(time.RFC3339),
+		Category: c.name,
+		Queued:   c.count(countQueued),
+		Fetched:  c.count(countFetched),
+		Parsed:   c.count(countParsed),
+		Failed:   c.count(countFailed),
+		Skipped:  c.count(countSkipped),
+		ETA:      -1,
+		Done:     atomic.LoadInt32(&c.finished) == 1,
+	}
+	if started := atomic.LoadInt64(&c.started); started != 0 {
+		event.Elapsed = now.Sub(time.Unix(0, started)).Seconds()
+	}
+	dealtWith := event.Parsed + event.Failed + event.Skipped
+	if event.Elapsed > 0 && dealtWith > 0 {
+		event.PerSecond = float64(dealtWith) / event.Elapsed
+		event.ETA = float64(event.Queued-dealtWith) / event.PerSecond
+	}
+	if event.Done {
+		event.ETA = 0
+	}
+	event.Elapsed = roundTo(event.Elapsed, 2)
+	event.PerSecond = roundTo(event.PerSecond, 2)
+	event.ETA = roundTo(event.ETA, 2)
+	return event
+}
+
+func roundTo(x float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(x*scale) / scale
+}
+
+// Shows how far along the categories of a run are, as a line redrawn in place on a terminal
+// or as periodic json events otherwise
+type Progress struct {
+	out      io.Writer
+	mode     ProgressMode
+	interval time.Duration
+
+	mtx        sync.Mutex
+	categories []*ProgressCounter
+	// Length of the line currently on screen
+	shown int
+}
+
+// Progress written to out every interval. In ProgressAuto the mode is picked by whether out
+// is a terminal. Line mode redraws more often than interval so it does not look stuck
+func NewProgress(out *os.File, mode ProgressMode, interval time.Duration) *Progress {
+	if mode == ProgressAuto {
+		mode = ProgressJSON
+		if isTerminal(out) {
+			mode = ProgressLine
+		}
+	}
+	if mode == ProgressLine {
+		interval = 250 * time.Millisecond
+	}
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &Progress{out: out, mode: mode, interval: interval}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Start counting a category, nil when progress is off so nothing gets counted
+func (p *Progress) Category(name string) *ProgressCounter {
+	if p == nil || p.mode == ProgressOff {
+		return nil
+	}
+	counter := &ProgressCounter{name: name, progress: p}
+	p.mtx.Lock()
+	p.categories = append(p.categories, counter)
+	p.mtx.Unlock()
+	return counter
+}
+
+// Report progress every interval until ctx is done
+func (p *Progress) Run(ctx context.Context) {
+	if p == nil || p.mode == ProgressOff {
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.mtx.Lock()
+			p.clearLine()
+			p.mtx.Unlock()
+			return
+		case now := <-ticker.C:
+			p.report(now)
+		}
+	}
+}
+
+func (p *Progress) report(now time.Time) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	var events []ProgressEvent
+	for _, category := range p.categories {
+		if atomic.LoadInt32(&category.finished) == 0 && atomic.LoadInt64(&category.started) != 0 {
+			events = append(events, category.snapshot(now))
+		}
+	}
+	if p.mode == ProgressJSON {
+		for _, event := range events {
+			p.writeEvent(event)
+		}
+		return
+	}
+	parts := make([]string, 0, len(events))
+	for _, event := range events {
+		parts = append(parts, formatProgress(event))
+	}
+	p.clearLine()
+	line := strings.Join(parts, " | ")
+	fmt.Fprint(p.out, line)
+	p.shown = len(line)
+}
+
+func (p *Progress) finished(c *ProgressCounter) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for i, category := range p.categories {
+		if category == c {
+			p.categories = append(p.categories[:i], p.categories[i+1:]...)
+			break
+		}
+	}
+	// A line mode run logs its own summary, the final event is for the json logs
+	if p.mode == ProgressJSON {
+		p.writeEvent(c.snapshot(time.Now()))
+	}
+}
+
+func (p *Progress) writeEvent(event ProgressEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	p.out.Write(append(data, '\n'))
+}
+
+// Must be called with the mutex held
+func (p *Progress) clearLine() {
+	if p.shown > 0 {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.shown = 0
+	}
+}
+
+// Wrap a writer sharing the terminal with the progress line, such as that of the loggers, so
+// the line is cleared before anything else is written and redrawn on the next tick
+func (p *Progress) Writer(w io.Writer) io.Writer {
+	if p == nil || p.mode != ProgressLine {
+		return w
+	}
+	return progressWriter{progress: p, inner: w}
+}
+
+type progressWriter struct {
+	progress *Progress
+	inner    io.Writer
+}
+
+func (w progressWriter) Write(data []byte) (int, error) {
+	w.progress.mtx.Lock()
+	defer w.progress.mtx.Unlock()
+	w.progress.clearLine()
+	return w.inner.Write(data)
+}
+
+func formatProgress(event ProgressEvent) string {
+	dealtWith := event.Parsed + event.Failed + event.Skipped
+	line := fmt.Sprintf("%s %d/%d, %d fetched, %d parsed, %d failed", event.Category, dealtWith, event.Queued, event.Fetched, event.Parsed, event.Failed)
+	if event.Skipped > 0 {
+		line += fmt.Sprintf(", %d skipped", event.Skipped)
+	}
+	if event.PerSecond > 0 {
+		line += fmt.Sprintf(", %.1f/s", event.PerSecond)
+	}
+	if event.ETA >= 0 {
+		line += ", ETA " + (time.Duration(event.ETA) * time.Second).String()
+	}
+	return line
+}
@@ -0,0 +1,102 @@
+package multiscraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressSnapshot(t *testing.T) {
+	var out bytes.Buffer
+	progress := &Progress{out: &out, mode: ProgressJSON, interval: time.Second}
+	counter := progress.Category("skins")
+	counter.queue(10)
+	for i := 0; i < 4; i++ {
+		counter.fetch()
+	}
+	counter.parse()
+	counter.parse()
+	counter.fail()
+	counter.skip()
+	now := time.Now()
+	counter.started = now.Add(-4 * time.Second).UnixNano()
+
+	// 4 of 10 dealt with in 4 seconds, the other 6 take another 6
+	event := counter.snapshot(now)
+	want := ProgressEvent{
+		Event: "progress", Time: now.UTC().Format(time.RFC3339), Category: "skins",
+		Queued: 10, Fetched: 4, Parsed: 2, Failed: 1, Skipped: 1,
+		Elapsed: 4, PerSecond: 1, ETA: 6,
+	}
+	if event != want {
+		t.Errorf("snapshot = %+v\nwant       %+v", event, want)
+	}
+	if line := formatProgress(event); line != "skins 4/10, 4 fetched, 2 parsed, 1 failed, 1 skipped, 1.0/s, ETA 6s" {
+		t.Errorf("line = %q", line)
+	}
+
+	progress.report(now)
+	counter.finish()
+	counter.finish()
+	var events []ProgressEvent
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var event ProgressEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 2 || events[0].Done || !events[1].Done || events[1].ETA != 0 {
+		t.Errorf("events = %+v, want a progress event then a single done one", events)
+	}
+	if len(progress.categories) != 0 {
+		t.Error("finished category is still reported")
+	}
+}
+
+func TestProgressWithoutCounts(t *testing.T) {
+	// Nothing dealt with yet, there is no rate to work out an ETA from
+	counter := (&Progress{mode: ProgressJSON}).Category("skins")
+	counter.queue(3)
+	if event := counter.snapshot(time.Now()); event.ETA != -1 || event.PerSecond != 0 {
+		t.Errorf("snapshot = %+v, want no rate and an unknown ETA", event)
+	}
+	if line := formatProgress(ProgressEvent{Category: "skins", Queued: 3, ETA: -1}); line != "skins 0/3, 0 fetched, 0 parsed, 0 failed" {
+		t.Errorf("line = %q", line)
+	}
+
+	// Progress that is off counts nothing, through a nil counter
+	counter = (&Progress{mode: ProgressOff}).Category("skins")
+	if counter != nil {
+		t.Fatal("counter handed out while progress is off")
+	}
+	counter.queue(1)
+	counter.parse()
+	counter.finish()
+}
+
+func TestMultiScrapeCountsProgress(t *testing.T) {
+	var out bytes.Buffer
+	opts := DefaultOptions
+	opts.Name = "skins"
+	opts.Retry.MaxAttempts = 1
+	opts.Progress = &Progress{out: &out, mode: ProgressJSON, interval: time.Hour}
+	opts.Fetcher = NewMapFetcher(map[string]string{
+		"http://site.example/1": "first",
+		"http://site.example/2": "second",
+	})
+	urls := []string{"http://site.example/1", "http://site.example/2", "http://site.example/missing"}
+	MultiScrape[string](context.Background(), urls, make(map[string]string), opts, ScraperFunc[string](scrapePath))
+
+	var event ProgressEvent
+	if err := json.Unmarshal(out.Bytes(), &event); err != nil {
+		t.Fatalf("%s: %s", out.String(), err)
+	}
+	// The first page queues a third that is missing too
+	if event.Category != "skins" || !event.Done || event.Queued != 4 || event.Fetched != 2 || event.Parsed != 2 || event.Failed != 2 || event.ETA != 0 {
+		t.Errorf("last event = %+v", event)
+	}
+}
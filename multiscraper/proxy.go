@@ -0,0 +1,208 @@
+package multiscraper
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings for a ProxyPool
+type ProxyPoolConfig struct {
+	// A proxy is taken out of rotation once this share of its recent requests failed
+	MaxErrorRate float64
+	// A proxy is taken out of rotation once its recent requests take longer than this on
+	// average, 0 for no limit
+	MaxLatency time.Duration
+	// Requests a proxy has to have served before its health is judged
+	MinRequests int
+	// How long a proxy stays out of rotation
+	Cooldown time.Duration
+}
+
+var DefaultProxyPoolConfig = ProxyPoolConfig{
+	MaxErrorRate: 0.5,
+	MaxLatency:   10 * time.Second,
+	MinRequests:  5,
+	Cooldown:     2 * time.Minute,
+}
+
+// Weight of the latest request in the moving averages a proxy's health is judged on
+const proxyHealthWeight = 0.2
+
+// Proxies a HTTPFetcher spreads its requests over in turn. Every request is reported back so
+// that proxies which keep failing or answer slowly are benched for a cooldown
+type ProxyPool struct {
+	mtx     sync.Mutex
+	config  ProxyPoolConfig
+	proxies []*proxyState
+	next    int
+}
+
+type proxyState struct {
+	url      *url.URL
+	requests int
+	failures int
+	// Moving averages over recent requests
+	errorRate float64
+	latency   float64
+	// Out of rotation until then
+	benchedUntil time.Time
+}
+
+// Health of a proxy in a ProxyPool
+type ProxyStats struct {
+	// Proxy url with any password removed
+	URL      string
+	Requests int
+	Failures int
+	Latency  time.Duration
+	Benched  bool
+}
+
+func NewProxyPool(proxies []string, config ProxyPoolConfig) (*ProxyPool, error) {
+	if config.MaxErrorRate <= 0 {
+		config.MaxErrorRate = DefaultProxyPoolConfig.MaxErrorRate
+	}
+	if config.MinRequests < 1 {
+		config.MinRequests = 1
+	}
+	pool := &ProxyPool{config: config}
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		parsed, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.Scheme == "" || parsed.Host == "" {
+			return nil, fmt.Errorf("proxy %q needs a scheme and host, such as http://host:port", proxy)
+		}
+		pool.proxies = append(pool.proxies, &proxyState{url: parsed})
+	}
+	if len(pool.proxies) == 0 {
+		return nil, fmt.Errorf("no proxies given")
+	}
+	return pool, nil
+}
+
+// Next proxy in rotation. When every proxy is benched the one closest to the end of its
+// cooldown is used rather than stalling the run
+func (p *ProxyPool) pick() *proxyState {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	now := time.Now()
+	for i := 0; i < len(p.proxies); i++ {
+		proxy := p.proxies[(p.next+i)%len(p.proxies)]
+		if now.After(proxy.benchedUntil) {
+			p.next = (p.next + i + 1) % len(p.proxies)
+			return proxy
+		}
+	}
+	soonest := p.proxies[0]
+	for _, proxy := range p.proxies[1:] {
+		if proxy.benchedUntil.Before(soonest.benchedUntil) {
+			soonest = proxy
+		}
+	}
+	return soonest
+}
+
+// Record the outcome of a request sent through proxy and bench it if it is unhealthy
+func (p *ProxyPool) report(proxy *proxyState, latency time.Duration, failed bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	failure := 0.0
+	if failed {
+		failure = 1
+		proxy.failures++
+	}
+	if proxy.requests == 0 {
+		proxy.errorRate = failure
+		proxy.latency = float64(latency)
+	} else {
+		proxy.errorRate += proxyHealthWeight * (failure - proxy.errorRate)
+		proxy.latency += proxyHealthWeight * (float64(latency) - proxy.latency)
+	}
+	proxy.requests++
+
+	if proxy.requests < p.config.MinRequests || !time.Now().After(proxy.benchedUntil) {
+		return
+	}
+	slow := p.config.MaxLatency > 0 && time.Duration(proxy.latency) > p.config.MaxLatency
+	if proxy.errorRate > p.config.MaxErrorRate || slow {
+		proxy.benchedUntil = time.Now().Add(p.config.Cooldown)
+		// Give it a clean slate once the cooldown is over
+		proxy.errorRate = 0
+		proxy.latency = 0
+	}
+}
+
+// Health of every proxy in the pool, sorted by url
+func (p *ProxyPool) Stats() []ProxyStats {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	now := time.Now()
+	stats := make([]ProxyStats, 0, len(p.proxies))
+	for _, proxy := range p.proxies {
+		stats = append(stats, ProxyStats{
+			URL:      proxy.url.Redacted(),
+			Requests: proxy.requests,
+			Failures: proxy.failures,
+			Latency:  time.Duration(proxy.latency),
+			Benched:  now.Before(proxy.benchedUntil),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].URL < stats[j].URL })
+	return stats
+}
+
+// Whether a response means the proxy rather than the site is in trouble. Sites rate limiting
+// or blocking an address look the same as a bad proxy, so those count against it too
+func proxyFailed(statusCode int, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch statusCode {
+	case http.StatusForbidden, http.StatusProxyAuthRequired, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+type proxyContextKey struct{}
+
+// Transport.Proxy for clients built by NewClient, sends the request through the proxy the
+// fetcher picked for it and falls back to the environment otherwise
+func proxyForRequest(req *http.Request) (*url.URL, error) {
+	if proxy, ok := req.Context().Value(proxyContextKey{}).(*url.URL); ok {
+		return proxy, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+func withProxy(ctx context.Context, proxy *url.URL) context.Context {
+	return context.WithValue(ctx, proxyContextKey{}, proxy)
+}
+
+// Pick a user agent for a request, fallback when there are none to rotate through
+func pickUserAgent(userAgents []string, fallback string) string {
+	if len(userAgents) == 0 {
+		return fallback
+	}
+	return userAgents[rand.Intn(len(userAgents))]
+}
+
+func proxyName(proxy *proxyState) string {
+	if proxy == nil {
+		return ""
+	}
+	return proxy.url.Redacted()
+}
@@ -0,0 +1,103 @@
+package multiscraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A http proxy that answers every request itself with status, counting what it was sent
+func testProxy(t *testing.T, status int, hits *int64) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(hits, 1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProxyBenchedAndReturnsAfterCooldown(t *testing.T) {
+	var goodHits, badHits int64
+	good := testProxy(t, http.StatusOK, &goodHits)
+	bad := testProxy(t, http.StatusBadGateway, &badHits)
+
+	cooldown := 300 * time.Millisecond
+	pool, err := NewProxyPool([]string{bad.URL, good.URL}, ProxyPoolConfig{MaxErrorRate: 0.5, MinRequests: 3, Cooldown: cooldown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewHTTPFetcher(DefaultClientConfig)
+	fetcher.Proxies = pool
+	fetch := func() {
+		t.Helper()
+		if _, err := fetcher.Fetch(context.Background(), "http://site.invalid/page"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Turn about until the bad proxy has served enough requests to be judged
+	for i := 0; i < 6; i++ {
+		fetch()
+	}
+	if bad, good := atomic.LoadInt64(&badHits), atomic.LoadInt64(&goodHits); bad != 3 || good != 3 {
+		t.Fatalf("hits before benching = %d bad, %d good, want 3 each", bad, good)
+	}
+	if !benched(pool, bad.URL) {
+		t.Fatal("proxy failing every request was not benched")
+	}
+	if benched(pool, good.URL) {
+		t.Fatal("healthy proxy was benched")
+	}
+
+	for i := 0; i < 4; i++ {
+		fetch()
+	}
+	if hits := atomic.LoadInt64(&badHits); hits != 3 {
+		t.Errorf("benched proxy served %d more requests", hits-3)
+	}
+
+	time.Sleep(cooldown + 50*time.Millisecond)
+	if benched(pool, bad.URL) {
+		t.Fatal("proxy still benched after its cooldown")
+	}
+	fetch()
+	fetch()
+	if hits := atomic.LoadInt64(&badHits); hits != 4 {
+		t.Errorf("hits on the proxy after its cooldown = %d, want 4", hits)
+	}
+}
+
+func TestEveryProxyBenchedStillServes(t *testing.T) {
+	var hits int64
+	bad := testProxy(t, http.StatusBadGateway, &hits)
+	pool, err := NewProxyPool([]string{bad.URL}, ProxyPoolConfig{MaxErrorRate: 0.5, MinRequests: 1, Cooldown: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewHTTPFetcher(DefaultClientConfig)
+	fetcher.Proxies = pool
+	for i := 0; i < 3; i++ {
+		res, err := fetcher.Fetch(context.Background(), "http://site.invalid/page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusBadGateway {
+			t.Errorf("status = %d, want 502", res.StatusCode)
+		}
+	}
+	if got := atomic.LoadInt64(&hits); got != 3 {
+		t.Errorf("hits = %d, want 3", got)
+	}
+}
+
+func benched(pool *ProxyPool, proxyUrl string) bool {
+	for _, stats := range pool.Stats() {
+		if stats.URL == proxyUrl {
+			return stats.Benched
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package multiscraper
+
+import (
+	"context"
+	"sync"
+)
+
+// Url indices waiting to be fetched. Scrapers can add to it while the run is going, so the
+// run is only over once nothing is pending and every url handed out has been dealt with
+type urlQueue struct {
+	mtx     sync.Mutex
+	pending []int
+	// Urls handed out or pending that have not been dealt with yet
+	outstanding int
+	wake        chan struct{}
+}
+
+func newURLQueue(indices []int) *urlQueue {
+	return &urlQueue{
+		pending:     indices,
+		outstanding: len(indices),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+func (q *urlQueue) add(indices []int) {
+	if len(indices) == 0 {
+		return
+	}
+	q.mtx.Lock()
+	q.pending = append(q.pending, indices...)
+	q.outstanding += len(indices)
+	q.mtx.Unlock()
+	q.signal()
+}
+
+// Mark a url handed out by dispatch as dealt with, whatever became of it
+func (q *urlQueue) finish() {
+	q.mtx.Lock()
+	q.outstanding--
+	q.mtx.Unlock()
+	q.signal()
+}
+
+func (q *urlQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Feeds url indices to the fetchers until every url, including those queued along the way,
+// has been dealt with or ctx is cancelled
+func (q *urlQueue) dispatch(ctx context.Context, jobs chan<- int) {
+	defer close(jobs)
+	for {
+		q.mtx.Lock()
+		if len(q.pending) > 0 {
+			index := q.pending[0]
+			q.pending = q.pending[1:]
+			q.mtx.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- index:
+			}
+			continue
+		}
+		idle := q.outstanding == 0
+		q.mtx.Unlock()
+		if idle {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+	}
+}
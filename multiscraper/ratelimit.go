@@ -0,0 +1,261 @@
+package multiscraper
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Settings for a Limiter
+type LimiterConfig struct {
+	// Sustained number of requests per second allowed to each host
+	PerSecond float64
+	// Number of requests a host can be sent back to back after being idle
+	Burst int
+	// Slow a host down when it starts answering slowly or with 429/503, and speed it back up
+	// towards PerSecond once it recovers
+	Adaptive bool
+	// Responses slower than this count as the host struggling in adaptive mode
+	TargetLatency time.Duration
+	// Adaptive mode never slows a host down below this rate
+	MinPerSecond float64
+}
+
+var DefaultLimiterConfig = LimiterConfig{
+	PerSecond:     20,
+	Burst:         5,
+	Adaptive:      false,
+	TargetLatency: 2 * time.Second,
+	MinPerSecond:  1,
+}
+
+// Token bucket rate limiter keyed by host. A single limiter is meant to be shared between
+// every MultiScrape run so that consecutive scrapes of the same site respect the same budget
+type Limiter struct {
+	mtx    sync.Mutex
+	config LimiterConfig
+	hosts  map[string]*tokenBucket
+	// Rates set for specific hosts, overriding config.PerSecond
+	overrides map[string]float64
+	// Crawl-delay asked for by the robots.txt of a host, replaced whenever it is read again
+	crawlDelays map[string]time.Duration
+}
+
+type tokenBucket struct {
+	// Rate the host is currently allowed, below ceiling while adaptive mode is backing off
+	rate    float64
+	ceiling float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+}
+
+func NewLimiter(config LimiterConfig) *Limiter {
+	if config.PerSecond <= 0 {
+		config.PerSecond = DefaultLimiterConfig.PerSecond
+	}
+	if config.Burst < 1 {
+		config.Burst = 1
+	}
+	if config.MinPerSecond <= 0 || config.MinPerSecond > config.PerSecond {
+		config.MinPerSecond = config.PerSecond
+	}
+	return &Limiter{
+		config:      config,
+		hosts:       make(map[string]*tokenBucket),
+		overrides:   make(map[string]float64),
+		crawlDelays: make(map[string]time.Duration),
+	}
+}
+
+// Override the sustained rate for a single host
+func (l *Limiter) SetHostRate(host string, perSecond float64) {
+	if perSecond <= 0 {
+		return
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.overrides[host] = perSecond
+	l.relimit(host)
+}
+
+// Space requests to a host at least delay apart and take away its burst, as its robots.txt
+// asks. The delay replaces any set before, 0 lifts it. Returns the rate the host is allowed
+func (l *Limiter) SetCrawlDelay(host string, delay time.Duration) float64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if delay > 0 {
+		l.crawlDelays[host] = delay
+	} else {
+		delete(l.crawlDelays, host)
+	}
+	l.relimit(host)
+	perSecond, _ := l.limits(host)
+	return perSecond
+}
+
+// Current rate a host is allowed, which is below its configured rate while adaptive mode is
+// backing off
+func (l *Limiter) HostRate(host string) float64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.bucket(host).rate
+}
+
+// Block until a request to the host of webUrl is allowed or ctx is cancelled
+func (l *Limiter) Wait(ctx context.Context, webUrl string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	host := hostOf(webUrl)
+	delay := l.reserve(host, time.Now())
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// The request is not going to be made, leave its token to the next caller
+		l.release(host, time.Now())
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Feed the outcome of a request back to the limiter, statusCode is 0 if no response was received
+func (l *Limiter) Observe(webUrl string, latency time.Duration, statusCode int) {
+	if !l.config.Adaptive {
+		return
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	bucket := l.bucket(hostOf(webUrl))
+	bucket.refill(time.Now())
+	struggling := statusCode == http.StatusTooManyRequests ||
+		statusCode == http.StatusServiceUnavailable ||
+		(l.config.TargetLatency > 0 && latency > l.config.TargetLatency)
+	if struggling {
+		// Multiplicative decrease, additive increase
+		floor := l.config.MinPerSecond
+		if floor > bucket.ceiling {
+			floor = bucket.ceiling
+		}
+		bucket.rate /= 2
+		if bucket.rate < floor {
+			bucket.rate = floor
+		}
+	} else if bucket.rate < bucket.ceiling {
+		bucket.rate += bucket.ceiling / 20
+		if bucket.rate > bucket.ceiling {
+			bucket.rate = bucket.ceiling
+		}
+	}
+}
+
+// Take a token for the host, returning how long the caller has to wait before using it
+func (l *Limiter) reserve(host string, now time.Time) time.Duration {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	bucket := l.bucket(host)
+	bucket.refill(now)
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	// The bucket is in debt, wait until the token we just took has been earned
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+// Give back a token taken by reserve that was not used
+func (l *Limiter) release(host string, now time.Time) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	bucket := l.bucket(host)
+	bucket.refill(now)
+	bucket.tokens++
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+}
+
+// Must be called with the mutex held
+func (l *Limiter) bucket(host string) *tokenBucket {
+	bucket, ok := l.hosts[host]
+	if !ok {
+		rate, burst := l.limits(host)
+		bucket = &tokenBucket{
+			rate:    rate,
+			ceiling: rate,
+			burst:   burst,
+			tokens:  burst,
+			last:    time.Now(),
+		}
+		l.hosts[host] = bucket
+	}
+	return bucket
+}
+
+// Rate and burst a host is allowed by the config, its override and its crawl delay. Must be
+// called with the mutex held
+func (l *Limiter) limits(host string) (perSecond float64, burst float64) {
+	perSecond = l.config.PerSecond
+	if override, ok := l.overrides[host]; ok {
+		perSecond = override
+	}
+	burst = float64(l.config.Burst)
+	if delay, ok := l.crawlDelays[host]; ok {
+		if delayed := float64(time.Second) / float64(delay); delayed < perSecond {
+			perSecond = delayed
+		}
+		// A burst would send several requests with no delay between them at all
+		burst = 1
+	}
+	return perSecond, burst
+}
+
+// Bring the bucket of a host in line with its limits after they changed. Must be called with
+// the mutex held
+func (l *Limiter) relimit(host string) {
+	bucket, ok := l.hosts[host]
+	if !ok {
+		return
+	}
+	bucket.refill(time.Now())
+	perSecond, burst := l.limits(host)
+	// A host running at its old limit moves to the new one, one adaptive mode slowed down
+	// only has to stay under it
+	if bucket.rate >= bucket.ceiling || bucket.rate > perSecond {
+		bucket.rate = perSecond
+	}
+	bucket.ceiling = perSecond
+	bucket.burst = burst
+	if bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+func hostOf(webUrl string) string {
+	parsed, err := url.Parse(webUrl)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
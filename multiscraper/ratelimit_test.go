@@ -0,0 +1,138 @@
+package multiscraper
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReserveAllowsBurstThenSpacesRequests(t *testing.T) {
+	limiter := NewLimiter(LimiterConfig{PerSecond: 10, Burst: 3})
+	now := time.Now()
+	want := []time.Duration{0, 0, 0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, delay := range want {
+		if got := limiter.reserve("a.example", now); !closeTo(got, delay) {
+			t.Errorf("reserve %d = %s, want %s", i, got, delay)
+		}
+	}
+
+	// Other hosts have buckets of their own
+	if got := limiter.reserve("b.example", now); got != 0 {
+		t.Errorf("reserve on another host = %s, want 0", got)
+	}
+
+	// Idle long enough and the whole burst is back, but never more
+	later := now.Add(10 * time.Second)
+	for i := 0; i < 3; i++ {
+		if got := limiter.reserve("a.example", later); got != 0 {
+			t.Errorf("reserve %d after idling = %s, want 0", i, got)
+		}
+	}
+	if got := limiter.reserve("a.example", later); !closeTo(got, 100*time.Millisecond) {
+		t.Errorf("reserve past the refilled burst = %s, want 100ms", got)
+	}
+}
+
+func TestHostRateOverride(t *testing.T) {
+	limiter := NewLimiter(LimiterConfig{PerSecond: 10, Burst: 1})
+	limiter.SetHostRate("slow.example", 0.5)
+	now := time.Now()
+	limiter.reserve("slow.example", now)
+	if got := limiter.reserve("slow.example", now); !closeTo(got, 2*time.Second) {
+		t.Errorf("reserve on a 0.5/s host = %s, want 2s", got)
+	}
+	if got := limiter.HostRate("slow.example"); got != 0.5 {
+		t.Errorf("HostRate = %v, want 0.5", got)
+	}
+}
+
+func TestAdaptiveBacksOffAndRecovers(t *testing.T) {
+	limiter := NewLimiter(LimiterConfig{PerSecond: 20, Burst: 1, Adaptive: true, TargetLatency: time.Second, MinPerSecond: 4})
+	webUrl := "http://a.example/page"
+	limiter.Observe(webUrl, 10*time.Millisecond, 429)
+	if got := limiter.HostRate("a.example"); got != 10 {
+		t.Errorf("rate after a 429 = %v, want 10", got)
+	}
+	limiter.Observe(webUrl, 5*time.Second, 200)
+	limiter.Observe(webUrl, 5*time.Second, 200)
+	if got := limiter.HostRate("a.example"); got != 4 {
+		t.Errorf("rate after slow responses = %v, want the floor of 4", got)
+	}
+	for i := 0; i < 100; i++ {
+		limiter.Observe(webUrl, 10*time.Millisecond, 200)
+	}
+	if got := limiter.HostRate("a.example"); got != 20 {
+		t.Errorf("rate after recovering = %v, want 20", got)
+	}
+}
+
+// Delays are worked out in floating point, allow for rounding
+func closeTo(got time.Duration, want time.Duration) bool {
+	diff := got - want
+	return diff > -time.Millisecond && diff < time.Millisecond
+}
+
+func TestCrawlDelay(t *testing.T) {
+	limiter := NewLimiter(LimiterConfig{PerSecond: 10, Burst: 5})
+	limiter.SetHostRate("slow.example", 0.25)
+	now := time.Now()
+	limiter.reserve("a.example", now)
+	// Only ever lowers the rate, and takes away the burst
+	for host, want := range map[string]float64{"a.example": 0.5, "b.example": 0.5, "slow.example": 0.25} {
+		if got := limiter.SetCrawlDelay(host, 2*time.Second); got != want || limiter.HostRate(host) != want {
+			t.Errorf("rate of %s = %v, want %v", host, got, want)
+		}
+		limiter.reserve(host, now)
+		if got, delay := limiter.reserve(host, now), time.Duration(float64(time.Second)/want); !closeTo(got, delay) {
+			t.Errorf("second reserve on %s = %s, want %s", host, got, delay)
+		}
+	}
+
+	// A robots.txt read again without the delay gives the host its limits back
+	limiter.SetCrawlDelay("a.example", 0)
+	limiter.SetCrawlDelay("slow.example", 0)
+	if got := limiter.HostRate("a.example"); got != 10 {
+		t.Errorf("rate after lifting the delay = %v, want 10", got)
+	}
+	if got := limiter.HostRate("slow.example"); got != 0.25 {
+		t.Errorf("rate of an overridden host after lifting the delay = %v, want 0.25", got)
+	}
+	later := now.Add(time.Minute)
+	for i := 0; i < 5; i++ {
+		if got := limiter.reserve("a.example", later); got != 0 {
+			t.Errorf("reserve %d of the restored burst = %s, want 0", i, got)
+		}
+	}
+}
+
+func TestCancelledWaitGivesTokenBack(t *testing.T) {
+	limiter := NewLimiter(LimiterConfig{PerSecond: 1, Burst: 1})
+	webUrl := "http://a.example/page"
+	if err := limiter.Wait(context.Background(), webUrl); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, webUrl); err == nil {
+		t.Fatal("wait outlived its context")
+	}
+	// Only the token of the first wait is spent
+	if got := limiter.reserve("a.example", time.Now()); got > time.Second || got < 900*time.Millisecond {
+		t.Errorf("reserve after a cancelled wait = %s, want under 1s", got)
+	}
+}
+
+func TestAdaptiveIgnoresCachedPages(t *testing.T) {
+	limiter := NewLimiter(LimiterConfig{PerSecond: 20, Burst: 1, Adaptive: true, TargetLatency: time.Nanosecond, MinPerSecond: 1})
+	fetcher := fetcherFunc(func(ctx context.Context, webUrl string) (*Response, error) {
+		time.Sleep(time.Millisecond)
+		return &Response{URL: webUrl, StatusCode: http.StatusOK, Header: http.Header{}, FromCache: true}, nil
+	})
+	if _, _, err := fetchWithRetry(context.Background(), context.Background(), fetcher, "http://a.example/page", limiter, DefaultRetryPolicy, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := limiter.HostRate("a.example"); got != 20 {
+		t.Errorf("rate after a slow cached page = %v, want 20", got)
+	}
+}
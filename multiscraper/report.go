@@ -0,0 +1,164 @@
+package multiscraper
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Outcome of a MultiScrape run
+type Status int
+
+const (
+	// Every url was fetched and handed to the scraper
+	StatusComplete Status = iota
+	// The run was cancelled before every url could be scraped, the result map only
+	// holds what was scraped up until that point
+	StatusPartial
+	// An item was dropped by CollisionFail, the result map is missing it and should not be
+	// used as if the run had completed
+	StatusFailed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusComplete:
+		return "complete"
+	case StatusPartial:
+		return "partial"
+	case StatusFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Final state of a single url in a run
+type URLState int
+
+const (
+	// Never fetched because the run was cancelled first
+	URLSkipped URLState = iota
+	// Fetched and handed to the scraper
+	URLScraped
+	// Could not be fetched or parsed, or the scraper reported errors without finding any items
+	URLFailed
+	// Not fetched because robots.txt does not allow it
+	URLDisallowed
+)
+
+func (s URLState) String() string {
+	switch s {
+	case URLSkipped:
+		return "skipped"
+	case URLScraped:
+		return "scraped"
+	case URLFailed:
+		return "failed"
+	case URLDisallowed:
+		return "disallowed"
+	default:
+		return "unknown"
+	}
+}
+
+func (s URLState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Outcome of a single url in a run
+type URLResult struct {
+	URL   string   `json:"url"`
+	State URLState `json:"state"`
+	// Status code of the last response, 0 if no response was received
+	StatusCode int  `json:"status_code"`
+	Attempts   int  `json:"attempts"`
+	Bytes      int  `json:"bytes"`
+	FromCache  bool `json:"from_cache"`
+	// Scraped by an earlier run and skipped thanks to a checkpoint
+	Resumed bool `json:"resumed,omitempty"`
+	// Time spent on requests, not counting waits on the rate limiter or between retries
+	FetchDuration time.Duration `json:"-"`
+	// Breakdown of the last request, nil if it did not go over the network
+	Timing *Timing `json:"timing,omitempty"`
+	// Proxy the last request went through
+	Proxy string `json:"proxy,omitempty"`
+	// Time spent parsing the page and running the scraper
+	ParseDuration time.Duration `json:"-"`
+	// Number of items the scraper scraped from the page
+	Items int `json:"items"`
+	// Problems reported by the scraper, through Page.Warnf or by returning errors
+	Warnings []string `json:"warnings,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	// Why the page could not be fetched or parsed
+	Err error `json:"-"`
+}
+
+func (u URLResult) MarshalJSON() ([]byte, error) {
+	// Without the methods, so marshalling it does not recurse back into here
+	type plain URLResult
+	errors := u.Errors
+	if u.Err != nil {
+		errors = append([]string{u.Err.Error()}, errors...)
+	}
+	return json.Marshal(struct {
+		plain
+		FetchMillis float64  `json:"fetch_ms"`
+		ParseMillis float64  `json:"parse_ms"`
+		Errors      []string `json:"errors,omitempty"`
+	}{
+		plain:       plain(u),
+		FetchMillis: milliseconds(u.FetchDuration),
+		ParseMillis: milliseconds(u.ParseDuration),
+		Errors:      errors,
+	})
+}
+
+// Outcome of a MultiScrape run, URLs holds one entry per input url in the same order followed
+// by the urls queued with Page.Enqueue in the order they were queued
+type Result struct {
+	Status Status      `json:"status"`
+	URLs   []URLResult `json:"urls"`
+	// Items that were given under a key another item already had
+	Collisions []Collision `json:"collisions,omitempty"`
+}
+
+// Number of urls served from a cache
+func (r Result) CacheHits() int {
+	count := 0
+	for _, urlResult := range r.URLs {
+		if urlResult.FromCache {
+			count++
+		}
+	}
+	return count
+}
+
+// Number of urls scraped by an earlier run and skipped thanks to a checkpoint
+func (r Result) Resumed() int {
+	count := 0
+	for _, urlResult := range r.URLs {
+		if urlResult.Resumed {
+			count++
+		}
+	}
+	return count
+}
+
+// Number of urls that ended up in the given state
+func (r Result) Count(state URLState) int {
+	count := 0
+	for _, urlResult := range r.URLs {
+		if urlResult.State == state {
+			count++
+		}
+	}
+	return count
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
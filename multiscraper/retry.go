@@ -0,0 +1,206 @@
+package multiscraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How many times and how patiently a url is retried before it is given up on
+type RetryPolicy struct {
+	// Total number of attempts including the first, anything below 1 means a single attempt
+	MaxAttempts int
+	// Upper bound of the first backoff, doubled on every following attempt
+	BaseDelay time.Duration
+	// Backoff never grows past this, a Retry-After header from the server is honored even if longer
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// Error describing why a url could not be fetched
+type FetchError struct {
+	URL string
+	// Status code of the response, 0 if no response was received at all
+	StatusCode int
+	// Delay the server asked for through a Retry-After header, 0 if it gave none
+	RetryAfter time.Duration
+	// Whether trying again later could succeed, a 404 will never go away but a 503 might
+	Transient bool
+	Err       error
+}
+
+func (e *FetchError) Error() string {
+	kind := "permanent"
+	if e.Transient {
+		kind = "transient"
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s failure fetching %s: %s", kind, e.URL, e.Err)
+	}
+	return fmt.Sprintf("%s failure fetching %s: status %d", kind, e.URL, e.StatusCode)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Reports whether err is a fetch failure that is worth retrying
+func IsTransient(err error) bool {
+	var fetchErr *FetchError
+	return errors.As(err, &fetchErr) && fetchErr.Transient
+}
+
+// Status codes that signal the server is temporarily unable to give us the page
+var transientStatusCodes = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooEarly:            true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// Builds the error for a response that did not have a 200 status
+func statusError(webUrl string, res *Response) *FetchError {
+	fetchErr := &FetchError{
+		URL:        webUrl,
+		StatusCode: res.StatusCode,
+		Transient:  transientStatusCodes[res.StatusCode],
+	}
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+		fetchErr.RetryAfter = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+	}
+	return fetchErr
+}
+
+// Retry-After is either a number of seconds or an http date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// Exponential backoff with full jitter for the given attempt, where the first retry is attempt 1
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// What it took to fetch a url
+type fetchStats struct {
+	attempts int
+	// Status code of the last response, 0 if there was none
+	statusCode int
+	// Time spent on requests, not counting any waiting in between
+	duration time.Duration
+}
+
+// Fetch a url until it succeeds, fails permanently or runs out of attempts. Every attempt
+// that has to go over the network waits on the rate limiter first. Waits are cut short when
+// ctx is cancelled, the requests themselves are made with requestCtx
+func fetchWithRetry(ctx context.Context, requestCtx context.Context, fetcher Fetcher, webUrl string, limiter *Limiter, policy RetryPolicy, metrics *Metrics) (*Response, fetchStats, error) {
+	var stats fetchStats
+	for {
+		local, ok := fetcher.(LocalFetcher)
+		if !ok || !local.IsLocal(webUrl) {
+			waitStart := time.Now()
+			if err := limiter.Wait(ctx, webUrl); err != nil {
+				return nil, stats, err
+			}
+			metrics.observeWait(webUrl, time.Since(waitStart))
+		} else if err := ctx.Err(); err != nil {
+			return nil, stats, err
+		}
+		stats.attempts++
+		start := time.Now()
+		res, err := fetchOnce(requestCtx, fetcher, webUrl)
+		elapsed := time.Since(start)
+		stats.duration += elapsed
+		stats.statusCode = statusCodeOf(res, err)
+		// Pages served from the cache say nothing about how the host is doing
+		if res == nil || !res.FromCache {
+			limiter.Observe(webUrl, elapsed, stats.statusCode)
+		}
+		metrics.observeRequest(webUrl, stats.statusCode, elapsed)
+		if err == nil {
+			return res, stats, nil
+		}
+		if !IsTransient(err) || stats.attempts >= policy.MaxAttempts {
+			return nil, stats, err
+		}
+
+		delay := policy.backoff(stats.attempts)
+		var fetchErr *FetchError
+		if errors.As(err, &fetchErr) && fetchErr.RetryAfter > delay {
+			delay = fetchErr.RetryAfter
+		}
+		select {
+		case <-ctx.Done():
+			// Not the url's fault, let the caller tell it apart from a real failure
+			return nil, stats, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Make a single request, anything but a 200 is returned as a *FetchError
+func fetchOnce(ctx context.Context, fetcher Fetcher, webUrl string) (*Response, error) {
+	res, err := fetcher.Fetch(ctx, webUrl)
+	if err != nil {
+		// Network errors are worth another go, us giving up on the request or a page that will
+		// always be too big is not
+		transient := ctx.Err() == nil && !errors.Is(err, ErrBodyTooLarge)
+		fetchErr := &FetchError{URL: webUrl, Err: err, Transient: transient}
+		var pageErr *PageError
+		if errors.As(err, &pageErr) {
+			// There was a response, it just was not the page
+			fetchErr.StatusCode = http.StatusOK
+		}
+		return nil, fetchErr
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError(webUrl, res)
+	}
+	return res, nil
+}
+
+// Status code of a request outcome, 0 if there was no response
+func statusCodeOf(res *Response, err error) int {
+	if res != nil {
+		return res.StatusCode
+	}
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.StatusCode
+	}
+	return 0
+}
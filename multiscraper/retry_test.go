@@ -0,0 +1,125 @@
+package multiscraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		// A date in the past asks for no wait at all
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0},
+	}
+	for _, test := range tests {
+		if got := parseRetryAfter(test.value, now); got != test.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestBackoffStaysUnderCeiling(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	ceilings := map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	}
+	for attempt, ceiling := range ceilings {
+		for i := 0; i < 200; i++ {
+			if delay := policy.backoff(attempt); delay < 0 || delay > ceiling {
+				t.Fatalf("backoff(%d) = %s, want within [0, %s]", attempt, delay, ceiling)
+			}
+		}
+	}
+	if delay := (RetryPolicy{}).backoff(3); delay != 0 {
+		t.Errorf("backoff without a base delay = %s, want 0", delay)
+	}
+}
+
+func TestCancelledDuringBackoffIsSkipped(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := DefaultOptions
+	opts.PerSecond = 100
+	opts.Retry = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	opts.Fetcher = NewHTTPFetcher(DefaultClientConfig)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+	run := MultiScrape[string](ctx, []string{server.URL}, map[string]string{}, opts, ScraperFunc[string](nopScraper))
+
+	if run.Status != StatusPartial {
+		t.Errorf("status = %s, want partial", run.Status)
+	}
+	if state := run.URLs[0].State; state != URLSkipped {
+		t.Errorf("url state = %s, want skipped", state)
+	}
+	if run.URLs[0].Attempts != 1 {
+		t.Errorf("attempts = %d, want 1", run.URLs[0].Attempts)
+	}
+}
+
+func TestFetchWithRetryReturnsCancellation(t *testing.T) {
+	fetcher := fetcherFunc(func(ctx context.Context, webUrl string) (*Response, error) {
+		return &Response{URL: webUrl, StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	_, stats, err := fetchWithRetry(ctx, context.Background(), fetcher, "http://example.com/", NewLimiter(DefaultLimiterConfig), policy, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if stats.attempts != 1 {
+		t.Errorf("attempts = %d, want 1", stats.attempts)
+	}
+}
+
+// Fetcher made from a function, for tests that need full control over responses
+type fetcherFunc func(ctx context.Context, webUrl string) (*Response, error)
+
+func (f fetcherFunc) Fetch(ctx context.Context, webUrl string) (*Response, error) {
+	return f(ctx, webUrl)
+}
+
+func nopScraper(page *Page) ([]Keyed[string], []error) {
+	return nil, nil
+}
+
+func TestRobotsErrorIsFailureNotSkip(t *testing.T) {
+	opts := DefaultOptions
+	opts.PerSecond = 100
+	opts.Fetcher = fetcherFunc(func(ctx context.Context, webUrl string) (*Response, error) {
+		return &Response{URL: webUrl, StatusCode: http.StatusOK, Header: http.Header{}}, nil
+	})
+	opts.Robots = NewRobots(opts.Fetcher, nil)
+	run := MultiScrape[string](context.Background(), []string{"http://[::1"}, map[string]string{}, opts, ScraperFunc[string](nopScraper))
+	if state := run.URLs[0].State; state != URLFailed {
+		t.Errorf("url state = %s, want failed", state)
+	}
+	if run.URLs[0].Err == nil {
+		t.Error("expected the robots.txt error to be kept")
+	}
+}
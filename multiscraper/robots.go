@@ -0,0 +1,251 @@
+package multiscraper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gocasesapi/log"
+)
+
+// Product token we look for in the User-agent lines of robots.txt, groups for * apply when
+// no group names it. DefaultUserAgent carries it so sites can tell which group we follow
+var RobotsUserAgent = "gocasesapi"
+
+// Checks urls against the robots.txt of their host, which is downloaded once per host and
+// kept for as long as the Robots is. A Crawl-delay lowers the rate the limiter allows the host
+// and takes away its burst until a later Robots reads a robots.txt without one
+type Robots struct {
+	// Where robots.txt is fetched from, normally the same fetcher the pages come from
+	Fetcher Fetcher
+	Retry   RetryPolicy
+	// Hosts whose robots.txt is not looked at, such as mirrors we run ourselves. * ignores
+	// robots.txt everywhere
+	Ignore []string
+	// Where robots.txt requests are recorded, nothing is recorded if nil
+	Metrics *Metrics
+
+	mtx   sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	ready chan struct{}
+	rules *robotsRules
+	err   error
+}
+
+// Rules of the group that applies to us
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+func NewRobots(fetcher Fetcher, ignore []string) *Robots {
+	return &Robots{
+		Fetcher: fetcher,
+		Retry:   DefaultRetryPolicy,
+		Ignore:  ignore,
+		hosts:   make(map[string]*robotsEntry),
+	}
+}
+
+// Whether webUrl may be crawled. The first call for a host fetches its robots.txt, going
+// through the limiter like any other request
+func (r *Robots) Allowed(ctx context.Context, webUrl string, limiter *Limiter) (bool, error) {
+	parsed, err := url.Parse(webUrl)
+	if err != nil {
+		return false, err
+	}
+	if r.ignored(parsed.Host) {
+		return true, nil
+	}
+	rules, err := r.rulesFor(ctx, parsed, limiter)
+	if err != nil {
+		return false, err
+	}
+	return rules.allowed(parsed.RequestURI()), nil
+}
+
+func (r *Robots) ignored(host string) bool {
+	for _, ignore := range r.Ignore {
+		if ignore == "*" || strings.EqualFold(ignore, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Robots) rulesFor(ctx context.Context, parsed *url.URL, limiter *Limiter) (*robotsRules, error) {
+	host := parsed.Host
+	r.mtx.Lock()
+	if r.hosts == nil {
+		r.hosts = make(map[string]*robotsEntry)
+	}
+	entry, ok := r.hosts[host]
+	if !ok {
+		entry = &robotsEntry{ready: make(chan struct{})}
+		r.hosts[host] = entry
+	}
+	r.mtx.Unlock()
+
+	if ok {
+		select {
+		case <-entry.ready:
+			return entry.rules, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	robotsUrl := parsed.Scheme + "://" + host + "/robots.txt"
+	entry.rules, entry.err = r.fetch(ctx, robotsUrl, limiter)
+	if entry.err != nil {
+		// Nothing was learned about the host, whether the fetch was cancelled or failed some
+		// other way, let the next caller try again
+		r.mtx.Lock()
+		delete(r.hosts, host)
+		r.mtx.Unlock()
+	} else if limiter != nil {
+		// Also lifts a delay an earlier robots.txt of the host asked for, the limiter outlives us
+		perSecond := limiter.SetCrawlDelay(host, entry.rules.crawlDelay)
+		if entry.rules.crawlDelay > 0 {
+			log.Info.Printf("%s asks for a crawl delay of %s, limiting it to %.2f requests per second", robotsUrl, entry.rules.crawlDelay, perSecond)
+		}
+	}
+	close(entry.ready)
+	return entry.rules, entry.err
+}
+
+// Fetch and parse robots.txt. Following RFC 9309 a missing robots.txt allows everything and
+// one that cannot be reached disallows everything
+func (r *Robots) fetch(ctx context.Context, robotsUrl string, limiter *Limiter) (*robotsRules, error) {
+	if limiter == nil {
+		limiter = NewLimiter(DefaultLimiterConfig)
+	}
+	res, stats, err := fetchWithRetry(ctx, ctx, r.Fetcher, robotsUrl, limiter, r.Retry, r.Metrics)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err == nil {
+		return parseRobots(res.Body, RobotsUserAgent), nil
+	}
+	if stats.statusCode >= 400 && stats.statusCode < 500 {
+		return &robotsRules{}, nil
+	}
+	log.Warning.Printf("Could not fetch %s, treating every url on the host as disallowed: %s", robotsUrl, err)
+	return &robotsRules{rules: []robotsRule{{allow: false, pattern: "/"}}}, nil
+}
+
+// Rules from the groups naming userAgent, or from the * groups when none do
+func parseRobots(body []byte, userAgent string) *robotsRules {
+	userAgent = strings.ToLower(userAgent)
+	var ours, anyone robotsRules
+	foundOurs := false
+
+	// User agents of the group being read, a group starts at a run of User-agent lines
+	var agents []string
+	inRules := false
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if comment := strings.IndexByte(line, '#'); comment >= 0 {
+			line = line[:comment]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+			continue
+		}
+		inRules = true
+
+		for _, agent := range agents {
+			var group *robotsRules
+			if agent == userAgent {
+				group = &ours
+				foundOurs = true
+			} else if agent == "*" {
+				group = &anyone
+			} else {
+				continue
+			}
+			switch key {
+			case "allow", "disallow":
+				// An empty Disallow allows everything, which is what having no rule does
+				if value != "" {
+					group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value})
+				}
+			case "crawl-delay":
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					group.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+	if foundOurs {
+		return &ours
+	}
+	return &anyone
+}
+
+// The longest matching rule wins, Allow wins a tie
+func (r *robotsRules) allowed(path string) bool {
+	allowed := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed = rule.allow
+			longest = len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// Match a path against a robots.txt pattern, where * matches anything and a trailing $
+// anchors the pattern to the end of the path
+func robotsMatch(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	return robotsMatchFrom(strings.TrimSuffix(pattern, "$"), path, anchored)
+}
+
+func robotsMatchFrom(pattern string, path string, anchored bool) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		if anchored {
+			return path == pattern
+		}
+		return strings.HasPrefix(path, pattern)
+	}
+	if !strings.HasPrefix(path, pattern[:star]) {
+		return false
+	}
+	for i := star; i <= len(path); i++ {
+		if robotsMatchFrom(pattern[star+1:], path[i:], anchored) {
+			return true
+		}
+	}
+	return false
+}
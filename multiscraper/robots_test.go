@@ -0,0 +1,147 @@
+package multiscraper
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/anything", true},
+		{"/skins", "/skins/ak-47", true},
+		{"/skins", "/skin", false},
+		{"/skins$", "/skins", true},
+		{"/skins$", "/skins/ak-47", false},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/dir/index.php?x=1", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/*.php$", "/index.php", true},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+		{"*", "/", true},
+	}
+	for _, test := range tests {
+		if got := robotsMatch(test.pattern, test.path); got != test.want {
+			t.Errorf("robotsMatch(%q, %q) = %t, want %t", test.pattern, test.path, got, test.want)
+		}
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	body := []byte(`
+# Everyone else
+User-agent: *
+Disallow: /
+Crawl-delay: 30
+
+User-agent: OtherBot
+User-Agent: GoCasesAPI
+Disallow: /private
+Allow: /private/open
+Disallow:
+Crawl-delay: 2.5 # seconds
+
+User-agent: OtherBot
+Disallow: /other
+`)
+	rules := parseRobots(body, RobotsUserAgent)
+	if rules.crawlDelay != 2500*time.Millisecond {
+		t.Errorf("crawl delay = %s, want 2.5s", rules.crawlDelay)
+	}
+	allowed := map[string]bool{
+		"/":                   true,
+		"/skins":              true,
+		"/other":              true,
+		"/private":            false,
+		"/private/x":          false,
+		"/private/open":       true,
+		"/private/open/stuff": true,
+	}
+	for path, want := range allowed {
+		if got := rules.allowed(path); got != want {
+			t.Errorf("allowed(%q) = %t, want %t", path, got, want)
+		}
+	}
+
+	// Without a group of our own the * group applies
+	rules = parseRobots(body, "somebot")
+	if rules.allowed("/skins") || rules.crawlDelay != 30*time.Second {
+		t.Errorf("* group not applied, allowed /skins: %t, crawl delay %s", rules.allowed("/skins"), rules.crawlDelay)
+	}
+
+	// Nothing for us or for anyone allows everything
+	rules = parseRobots([]byte("User-agent: OtherBot\nDisallow: /\n"), RobotsUserAgent)
+	if !rules.allowed("/skins") {
+		t.Error("rules for another agent applied to us")
+	}
+}
+
+func TestDefaultUserAgentNamesRobotsToken(t *testing.T) {
+	if !strings.Contains(strings.ToLower(DefaultUserAgent), RobotsUserAgent) {
+		t.Errorf("DefaultUserAgent %q does not name %q", DefaultUserAgent, RobotsUserAgent)
+	}
+}
+
+func TestCrawlDelayLimitsRateAndBurst(t *testing.T) {
+	fetcher := NewMapFetcher(map[string]string{
+		"http://slow.example/robots.txt": "User-agent: *\nCrawl-delay: 2\n",
+	})
+	limiter := NewLimiter(LimiterConfig{PerSecond: 10, Burst: 5})
+	robots := NewRobots(fetcher, nil)
+	allowed, err := robots.Allowed(context.Background(), "http://slow.example/page", limiter)
+	if err != nil || !allowed {
+		t.Fatalf("Allowed = %t, %v, want true", allowed, err)
+	}
+	if got := limiter.HostRate("slow.example"); got != 0.5 {
+		t.Errorf("rate = %v, want 0.5", got)
+	}
+	// With no burst left to spend every request after the next waits out the delay
+	now := time.Now()
+	limiter.reserve("slow.example", now)
+	if got := limiter.reserve("slow.example", now); !closeTo(got, 2*time.Second) {
+		t.Errorf("delay between requests = %s, want 2s", got)
+	}
+}
+
+func TestNewRobotsReplacesCrawlDelay(t *testing.T) {
+	fetcher := NewMapFetcher(map[string]string{
+		"http://slow.example/robots.txt": "User-agent: *\nCrawl-delay: 2\n",
+	})
+	// Shared by every run, as in daemon mode
+	limiter := NewLimiter(LimiterConfig{PerSecond: 10, Burst: 5})
+	if _, err := NewRobots(fetcher, nil).Allowed(context.Background(), "http://slow.example/page", limiter); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher["http://slow.example/robots.txt"].Body = []byte("User-agent: *\nCrawl-delay: 1\n")
+	if _, err := NewRobots(fetcher, nil).Allowed(context.Background(), "http://slow.example/page", limiter); err != nil {
+		t.Fatal(err)
+	}
+	if got := limiter.HostRate("slow.example"); got != 1 {
+		t.Errorf("rate after a shorter delay = %v, want 1", got)
+	}
+
+	fetcher["http://slow.example/robots.txt"].Body = []byte("User-agent: *\nDisallow: /private\n")
+	if _, err := NewRobots(fetcher, nil).Allowed(context.Background(), "http://slow.example/page", limiter); err != nil {
+		t.Fatal(err)
+	}
+	if got := limiter.HostRate("slow.example"); got != 10 {
+		t.Errorf("rate after the delay was dropped = %v, want 10", got)
+	}
+}
+
+func TestMissingRobotsAllowsEverything(t *testing.T) {
+	fetcher := MapFetcher{"http://site.example/robots.txt": {StatusCode: http.StatusNotFound, Header: http.Header{}}}
+	robots := NewRobots(fetcher, nil)
+	allowed, err := robots.Allowed(context.Background(), "http://site.example/anything", NewLimiter(DefaultLimiterConfig))
+	if err != nil || !allowed {
+		t.Errorf("Allowed = %t, %v, want true", allowed, err)
+	}
+}
@@ -0,0 +1,97 @@
+package multiscraper
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"gocasesapi/log"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// An item scraped from a page and the key it is stored under in the result
+type Keyed[T any] struct {
+	Key string
+	// What the item is called before it was turned into a key, used to tell items apart when
+	// two of them end up with the same key
+	Name string
+	Item T
+}
+
+// Turns a page into items. Scrapers only look at the page they are given, so they need no
+// locking and can be tested on a page built from a string. Errors are problems that meant some
+// or all of the page could not be scraped, a page that gives errors and no items counts as failed
+type Scraper[T any] interface {
+	Scrape(page *Page) ([]Keyed[T], []error)
+}
+
+// Lets a plain function be used as a Scraper
+type ScraperFunc[T any] func(page *Page) ([]Keyed[T], []error)
+
+func (f ScraperFunc[T]) Scrape(page *Page) ([]Keyed[T], []error) {
+	return f(page)
+}
+
+// A document being scraped, along with the warnings and urls the scraper reported for it. A
+// page belongs to the one scraper call it is handed to and is not safe for concurrent use
+type Page struct {
+	*goquery.Document
+	warnings []string
+	links    []string
+}
+
+func NewPage(doc *goquery.Document) *Page {
+	return &Page{Document: doc}
+}
+
+// Report a problem with the page that did not stop items from being scraped from it. The
+// warning is logged and added to the report entry of the url the page came from
+func (p *Page) Warnf(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	log.Warning.Output(2, message)
+	p.warnings = append(p.warnings, message)
+}
+
+// Queue more urls into the run, such as the following pages of a listing. Relative urls are
+// resolved against the url of the page and urls the run already knows about are ignored
+func (p *Page) Enqueue(urls ...string) {
+	for _, webUrl := range urls {
+		if p.Url != nil {
+			parsed, err := p.Url.Parse(webUrl)
+			if err != nil {
+				p.Warnf("Not queueing %q: %s", webUrl, err)
+				continue
+			}
+			webUrl = parsed.String()
+		} else if _, err := url.Parse(webUrl); err != nil {
+			p.Warnf("Not queueing %q: %s", webUrl, err)
+			continue
+		}
+		p.links = append(p.links, webUrl)
+	}
+}
+
+// Warnings reported with Warnf, in the order they were reported
+func (p *Page) Warnings() []string {
+	return p.warnings
+}
+
+// Urls queued with Enqueue, resolved against the url of the page
+func (p *Page) Links() []string {
+	return p.links
+}
+
+// Name of the function or type behind a scraper, such as cs2.ScrapeSkinLink, that its metrics
+// are labelled with
+func scraperName[T any](scraper Scraper[T]) string {
+	if f, ok := scraper.(ScraperFunc[T]); ok && f != nil {
+		if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+			name := fn.Name()
+			return name[strings.LastIndex(name, "/")+1:]
+		}
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", scraper), "*")
+}
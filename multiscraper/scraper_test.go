@@ -0,0 +1,40 @@
+package multiscraper
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// Queues the relative link on the first page and warns about the bad one
+func linkingScraper(page *Page) ([]Keyed[string], []error) {
+	if page.Url.Path == "/1" {
+		page.Enqueue("2", "http://[::1")
+	}
+	page.Warnf("warned on %s", page.Url.Path)
+	return []Keyed[string]{{Key: page.Url.Path, Item: page.Url.Path}}, nil
+}
+
+func TestPageLinksAndWarnings(t *testing.T) {
+	opts := DefaultOptions
+	opts.Fetcher = NewMapFetcher(map[string]string{
+		"http://site.example/1": "first",
+		"http://site.example/2": "second",
+	})
+	result := make(map[string]string)
+	run := MultiScrape[string](context.Background(), []string{"http://site.example/1"}, result, opts, ScraperFunc[string](linkingScraper))
+
+	if len(run.URLs) != 2 || run.URLs[1].URL != "http://site.example/2" {
+		t.Fatalf("urls = %+v, want the queued page after the first", run.URLs)
+	}
+	if result["/2"] != "/2" {
+		t.Errorf("result = %v, want the queued page scraped", result)
+	}
+	warnings := strings.Join(run.URLs[0].Warnings, "; ")
+	if !strings.Contains(warnings, `Not queueing "http://[::1"`) || !strings.Contains(warnings, "warned on /1") {
+		t.Errorf("first page warnings = %q", warnings)
+	}
+	if len(run.URLs[1].Warnings) != 1 || run.URLs[1].Warnings[0] != "warned on /2" {
+		t.Errorf("queued page warnings = %q, want only its own", run.URLs[1].Warnings)
+	}
+}
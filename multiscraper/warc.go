@@ -0,0 +1,270 @@
+package multiscraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Where a scraped item came from. Only filled in when the page was downloaded through a
+// WARCFetcher, WARCFile, WARCRecordID and WARCOffset point at the response record holding the page
+type Source struct {
+	URL          string    `json:"url"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	WARCFile     string    `json:"warc_file"`
+	WARCRecordID string    `json:"warc_record_id"`
+	// Byte offset of the record in WARCFile, for a .warc.gz this is the offset of its gzip member
+	WARCOffset int64 `json:"warc_offset"`
+	// Served by a CachingFetcher, the record is that of the download the cache entry came from,
+	// which may be in the WARC file of an earlier run
+	FromCache bool `json:"from_cache,omitempty"`
+}
+
+// Items that can record the page they were scraped from. MultiScrape calls SetSource on every
+// item scraped from a page that has a Source
+type Sourced interface {
+	SetSource(*Source)
+}
+
+// Writes request and response records to a WARC 1.1 file. When the file name ends in .gz
+// every record is written as its own gzip member, as is the convention for .warc.gz
+type WARCWriter struct {
+	Path string
+
+	mtx        sync.Mutex
+	file       *os.File
+	offset     int64
+	compressed bool
+}
+
+func NewWARCWriter(path string) (*WARCWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &WARCWriter{Path: path, file: file, compressed: strings.HasSuffix(path, ".gz")}
+
+	info := "software: gocasesapi\r\nformat: WARC File Format 1.1\r\nconformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n"
+	_, err = w.writeRecord([]warcField{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", warcDate(time.Now())},
+		{"WARC-Filename", filepath.Base(path)},
+		{"Content-Type", "application/warc-fields"},
+	}, []byte(info))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Profile of the revisit records written for 304 responses
+const warcNotModifiedProfile = "http://netpreserve.org/warc/1.1/revisit/server-not-modified"
+
+// Write a request and response record pair for a fetched page. The request record holds the
+// headers res was requested with, such as the user agent and those of a conditional request,
+// and both records use the protocol it was answered over. A 304 is written as a revisit record
+// since it has no payload of its own. The http messages are rebuilt from the Response since
+// fetchers do not hand out the raw bytes on the wire
+func (w *WARCWriter) WriteExchange(res *Response, fetchedAt time.Time) (*Source, error) {
+	parsed, err := url.Parse(res.URL)
+	if err != nil {
+		return nil, err
+	}
+	date := warcDate(fetchedAt)
+	proto := res.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+
+	var request bytes.Buffer
+	fmt.Fprintf(&request, "GET %s %s\r\nHost: %s\r\n", parsed.RequestURI(), proto, parsed.Host)
+	res.RequestHeader.Write(&request)
+	request.WriteString("\r\n")
+
+	var response bytes.Buffer
+	fmt.Fprintf(&response, "%s %d %s\r\n", proto, res.StatusCode, http.StatusText(res.StatusCode))
+	header := res.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	// The body has already been decoded, describe it as it is stored
+	header.Del("Content-Encoding")
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", fmt.Sprint(len(res.Body)))
+	header.Write(&response)
+	response.WriteString("\r\n")
+	response.Write(res.Body)
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	responseID := newRecordID()
+	fields := []warcField{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", res.URL},
+		{"WARC-Payload-Digest", digest(res.Body)},
+		{"Content-Type", "application/http;msgtype=response"},
+	}
+	if res.StatusCode == http.StatusNotModified {
+		fields = []warcField{
+			{"WARC-Type", "revisit"},
+			{"WARC-Record-ID", responseID},
+			{"WARC-Date", date},
+			{"WARC-Target-URI", res.URL},
+			{"WARC-Profile", warcNotModifiedProfile},
+			{"Content-Type", "application/http;msgtype=response"},
+		}
+	}
+	offset, err := w.writeRecord(fields, response.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.writeRecord([]warcField{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", res.URL},
+		{"WARC-Concurrent-To", responseID},
+		{"Content-Type", "application/http;msgtype=request"},
+	}, request.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Source{
+		URL:          res.URL,
+		FetchedAt:    fetchedAt.UTC(),
+		WARCFile:     w.Path,
+		WARCRecordID: responseID,
+		WARCOffset:   offset,
+	}, nil
+}
+
+func (w *WARCWriter) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.file.Close()
+}
+
+type warcField struct {
+	name  string
+	value string
+}
+
+// Must be called with the mutex held, returns the offset the record starts at
+func (w *WARCWriter) writeRecord(fields []warcField, block []byte) (int64, error) {
+	fields = append(fields,
+		warcField{"WARC-Block-Digest", digest(block)},
+		warcField{"Content-Length", fmt.Sprint(len(block))},
+	)
+
+	var record bytes.Buffer
+	record.WriteString("WARC/1.1\r\n")
+	for _, field := range fields {
+		fmt.Fprintf(&record, "%s: %s\r\n", field.name, field.value)
+	}
+	record.WriteString("\r\n")
+	record.Write(block)
+	record.WriteString("\r\n\r\n")
+
+	offset := w.offset
+	counter := &countingWriter{w: w.file}
+	var out io.Writer = counter
+	var gz *gzip.Writer
+	if w.compressed {
+		gz = gzip.NewWriter(counter)
+		out = gz
+	}
+	_, err := out.Write(record.Bytes())
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	w.offset += counter.n
+	return offset, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Wraps a fetcher and writes every response it gives to a WARC file, tagging the response
+// with the Source of the record. It belongs right on top of the HTTPFetcher doing the
+// downloading, under any CachingFetcher, so only what actually came over the network is archived
+type WARCFetcher struct {
+	Inner  Fetcher
+	Writer *WARCWriter
+}
+
+func (f *WARCFetcher) IsLocal(webUrl string) bool {
+	local, ok := f.Inner.(LocalFetcher)
+	return ok && local.IsLocal(webUrl)
+}
+
+func (f *WARCFetcher) Fetch(ctx context.Context, webUrl string) (*Response, error) {
+	return f.FetchWithHeader(ctx, webUrl, nil)
+}
+
+func (f *WARCFetcher) FetchWithHeader(ctx context.Context, webUrl string, header http.Header) (*Response, error) {
+	var res *Response
+	var err error
+	if headerFetcher, ok := f.Inner.(HeaderFetcher); ok {
+		res, err = headerFetcher.FetchWithHeader(ctx, webUrl, header)
+	} else {
+		res, err = f.Inner.Fetch(ctx, webUrl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Inner fetchers may hand out shared responses, tag a copy
+	sourced := *res
+	if sourced.RequestHeader == nil {
+		// Not told what was sent, the extra headers are the best we know
+		sourced.RequestHeader = header
+	}
+	sourced.Source, err = f.Writer.WriteExchange(&sourced, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("writing %s to %s: %w", webUrl, f.Writer.Path, err)
+	}
+	return &sourced, nil
+}
+
+func warcDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+func newRecordID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	// Version 4 uuid
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
@@ -0,0 +1,125 @@
+package multiscraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var warcTypeLine = regexp.MustCompile(`(?m)^WARC-Type: (\S+)\r$`)
+
+func TestWARCUnderCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("<html>page</html>"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	writer, err := NewWARCWriter(filepath.Join(dir, "run.warc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	warc := &WARCFetcher{Inner: NewHTTPFetcher(DefaultClientConfig), Writer: writer}
+	cache := NewCachingFetcher(filepath.Join(dir, "cache"), warc, 0)
+	ctx := context.Background()
+
+	first, err := cache.Fetch(ctx, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.FromCache || first.Source == nil || first.Source.FromCache {
+		t.Fatalf("download = from cache %t, source %+v", first.FromCache, first.Source)
+	}
+
+	// Revalidated with a 304, the page and its record are those of the first download
+	revalidated, err := cache.Fetch(ctx, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(revalidated.Body) != "<html>page</html>" || !revalidated.FromCache {
+		t.Fatalf("revalidated page = %q, from cache %t", revalidated.Body, revalidated.FromCache)
+	}
+	if source := revalidated.Source; source == nil || !source.FromCache || source.WARCRecordID != first.Source.WARCRecordID {
+		t.Errorf("revalidated source = %+v, want the first record marked from cache", source)
+	}
+
+	// Served without a request, nothing is written
+	cache.TTL = time.Hour
+	hit, err := cache.Fetch(ctx, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source := hit.Source; source == nil || !source.FromCache || source.WARCRecordID != first.Source.WARCRecordID {
+		t.Errorf("cache hit source = %+v, want the first record marked from cache", source)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(writer.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, match := range warcTypeLine.FindAllStringSubmatch(string(data), -1) {
+		types = append(types, match[1])
+	}
+	want := []string{"warcinfo", "response", "request", "revisit", "request"}
+	if strings.Join(types, " ") != strings.Join(want, " ") {
+		t.Errorf("records = %v, want %v", types, want)
+	}
+	if !strings.Contains(string(data), "WARC-Profile: "+warcNotModifiedProfile) {
+		t.Error("revisit record has no server-not-modified profile")
+	}
+	for _, line := range []string{
+		"If-None-Match: \"v1\"\r\n",
+		"User-Agent: " + DefaultUserAgent + "\r\n",
+		"Accept-Encoding: " + acceptEncoding + "\r\n",
+		"GET / HTTP/1.1\r\n",
+	} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("request line or header %q was not archived", line)
+		}
+	}
+}
+
+func TestWARCKeepsProtocol(t *testing.T) {
+	writer, err := NewWARCWriter(filepath.Join(t.TempDir(), "run.warc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.WriteExchange(&Response{
+		URL:           "https://site.example/page?x=1",
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"text/html"}},
+		Body:          []byte("page"),
+		RequestHeader: http.Header{"User-Agent": {"agent"}},
+		Proto:         "HTTP/2.0",
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(writer.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"\r\nHTTP/2.0 200 OK\r\n", "\r\nGET /page?x=1 HTTP/2.0\r\nHost: site.example\r\nUser-Agent: agent\r\n"} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("record is missing %q", line)
+		}
+	}
+}
@@ -5,22 +5,45 @@ import (
 	"encoding/json"
 	"gocasesapi/log"
 	"os"
+	"path/filepath"
 )
 
+// Writes data as indented json. An interrupted run never leaves a half written file behind,
+// see WriteFileAtomic
 func WriteJsonToFile(filename string, data interface{}) {
 	jsonData, err := json.MarshalIndent(data, "", " ")
 	if err != nil {
 		log.Error.Panicln(err)
 	}
 
-	file, err := os.Create(filename)
+	err = WriteFileAtomic(filename, jsonData)
 	if err != nil {
 		log.Error.Panicln(err)
 	}
-	_, err = file.Write(jsonData)
+}
+
+// Writes data to a temporary file next to path and renames it into place, so readers only
+// ever see the old or the new contents
+func WriteFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
 	if err != nil {
-		log.Error.Panicln(err)
+		return err
+	}
+	// CreateTemp makes the file private, match what os.Create would have given us
+	err = file.Chmod(0644)
+	if err == nil {
+		_, err = file.Write(data)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
 	}
+	return err
 }
 
 func ReadLines(path string) ([]string, error) {